@@ -0,0 +1,237 @@
+// The admin package speaks the administrative text protocol of
+// Gearmand, as gearadmin does.
+package admin
+
+import (
+	"bufio"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	Network = "tcp"
+)
+
+// Admin is a connection to the administrative interface of one
+// job server.
+type Admin struct {
+	sync.Mutex
+
+	net, addr string
+	conn      net.Conn
+	rw        *bufio.ReadWriter
+}
+
+// FuncStatus is a line of the "status" command.
+type FuncStatus struct {
+	Name    string
+	Queued  uint64 // jobs in the queue, including running ones
+	Running uint64
+	Workers uint64 // available workers
+}
+
+// WorkerStatus is a line of the "workers" command.
+type WorkerStatus struct {
+	Fd       int
+	Ip       string
+	ClientId string // "-" if the worker didn't set one
+	Funcs    []string
+}
+
+// New returns an admin connection.
+func New(network, addr string) (admin *Admin, err error) {
+	admin = &Admin{
+		net:  network,
+		addr: addr,
+	}
+	admin.conn, err = net.Dial(admin.net, admin.addr)
+	if err != nil {
+		return
+	}
+	admin.rw = bufio.NewReadWriter(bufio.NewReader(admin.conn),
+		bufio.NewWriter(admin.conn))
+	return
+}
+
+// Close connection
+func (admin *Admin) Close() (err error) {
+	admin.Lock()
+	defer admin.Unlock()
+	if admin.conn != nil {
+		err = admin.conn.Close()
+		admin.conn = nil
+	}
+	return
+}
+
+// Status lists the registered functions.
+func (admin *Admin) Status() (status []*FuncStatus, err error) {
+	var lines []string
+	if lines, err = admin.list("status"); err != nil {
+		return
+	}
+	return parseStatus(lines)
+}
+
+// Workers lists the connected workers.
+func (admin *Admin) Workers() (workers []*WorkerStatus, err error) {
+	var lines []string
+	if lines, err = admin.list("workers"); err != nil {
+		return
+	}
+	return parseWorkers(lines)
+}
+
+// FUNCTION\tTOTAL\tRUNNING\tAVAILABLE_WORKERS
+func parseStatus(lines []string) (status []*FuncStatus, err error) {
+	status = make([]*FuncStatus, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			return nil, &ParseError{"status", line, "4 fields expected"}
+		}
+		fs := &FuncStatus{Name: fields[0]}
+		for i, v := range []*uint64{&fs.Queued, &fs.Running, &fs.Workers} {
+			if *v, err = strconv.ParseUint(fields[i+1], 10, 64); err != nil {
+				return nil, &ParseError{"status", line, "Invalid Integer"}
+			}
+		}
+		status = append(status, fs)
+	}
+	return
+}
+
+// FD IP-ADDRESS CLIENT-ID : FUNCTION ...
+func parseWorkers(lines []string) (workers []*WorkerStatus, err error) {
+	workers = make([]*WorkerStatus, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[3] != ":" {
+			return nil, &ParseError{"workers", line, "FD IP-ADDRESS CLIENT-ID : expected"}
+		}
+		ws := &WorkerStatus{Ip: fields[1], ClientId: fields[2],
+			Funcs: fields[4:]}
+		if ws.Fd, err = strconv.Atoi(fields[0]); err != nil {
+			return nil, &ParseError{"workers", line, "Invalid Integer"}
+		}
+		workers = append(workers, ws)
+	}
+	return
+}
+
+// MaxQueue sets the maximum queue size of the function.
+// A negative size removes the limit.
+func (admin *Admin) MaxQueue(funcname string, size int) (err error) {
+	cmd := "maxqueue " + funcname
+	if size >= 0 {
+		cmd += " " + strconv.Itoa(size)
+	}
+	_, err = admin.ok(cmd)
+	return
+}
+
+// Version returns the version of the job server.
+func (admin *Admin) Version() (version string, err error) {
+	return admin.ok("version")
+}
+
+// GetPid returns the process ID of the job server.
+func (admin *Admin) GetPid() (pid int, err error) {
+	var s string
+	if s, err = admin.ok("getpid"); err != nil {
+		return
+	}
+	if pid, err = strconv.Atoi(s); err != nil {
+		return 0, &ParseError{"getpid", s, "Invalid Integer"}
+	}
+	return
+}
+
+// Shutdown the job server. If graceful is true, the server stops
+// accepting connections and waits for the queued jobs to be done.
+func (admin *Admin) Shutdown(graceful bool) (err error) {
+	cmd := "shutdown"
+	if graceful {
+		cmd += " graceful"
+	}
+	_, err = admin.ok(cmd)
+	return
+}
+
+// CancelJob removes a queued job which is not running yet.
+func (admin *Admin) CancelJob(handle string) (err error) {
+	_, err = admin.ok("cancel job " + handle)
+	return
+}
+
+// Send a command which is answered with a single "OK" line,
+// the rest of the line is returned.
+func (admin *Admin) ok(cmd string) (rest string, err error) {
+	admin.Lock()
+	defer admin.Unlock()
+	if err = admin.write(cmd); err != nil {
+		return
+	}
+	var line string
+	if line, err = admin.readLine(); err != nil {
+		return
+	}
+	if line != "OK" && !strings.HasPrefix(line, "OK ") {
+		return "", &ParseError{cmd, line, "OK expected"}
+	}
+	rest = strings.TrimSpace(line[2:])
+	return
+}
+
+// Send a command which is answered with lines ending with ".".
+func (admin *Admin) list(cmd string) (lines []string, err error) {
+	admin.Lock()
+	defer admin.Unlock()
+	if err = admin.write(cmd); err != nil {
+		return
+	}
+	for {
+		var line string
+		if line, err = admin.readLine(); err != nil {
+			return nil, err
+		}
+		if line == "." {
+			return
+		}
+		lines = append(lines, line)
+	}
+}
+
+func (admin *Admin) write(cmd string) (err error) {
+	if admin.conn == nil {
+		return ErrLostConn
+	}
+	if _, err = admin.rw.WriteString(cmd + "\n"); err != nil {
+		return
+	}
+	return admin.rw.Flush()
+}
+
+// Read a line, "ERR" lines are turned into *ServerError.
+func (admin *Admin) readLine() (line string, err error) {
+	if line, err = admin.rw.ReadString('\n'); err != nil {
+		return
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "ERR ") {
+		e := &ServerError{}
+		s := strings.SplitN(line[4:], " ", 2)
+		e.Code = s[0]
+		if len(s) == 2 {
+			// Gearmand encodes spaces in the message as '+'
+			if e.Message, err = url.QueryUnescape(s[1]); err != nil {
+				e.Message = s[1]
+			}
+		}
+		return "", e
+	}
+	return
+}
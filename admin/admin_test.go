@@ -0,0 +1,158 @@
+package admin
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	responses = map[string]string{
+		"status": "ToUpper\t2\t1\t3\nSysInfo\t0\t0\t1\n.\n",
+		"workers": "33 127.0.0.1 - : ToUpper SysInfo\n" +
+			"34 ::1 worker-1 :\n.\n",
+		"maxqueue ToUpper 10": "OK\n",
+		"maxqueue ToUpper":    "OK\n",
+		"version":             "OK 1.1.19\n",
+		"getpid":              "OK 4242\n",
+		"shutdown graceful":   "OK\n",
+		"cancel job H:lap:1":  "OK\n",
+		"cancel job H:lap:2":  "ERR UNKNOWN_JOB Unknown+job\r\n",
+	}
+)
+
+// fake job server, answers commands with the canned responses
+func fakeServer(t *testing.T) (addr string, closer func()) {
+	l, err := net.Listen(Network, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimSpace(line)
+					res, ok := responses[line]
+					if !ok {
+						res = "ERR UNKNOWN_COMMAND Unknown+server+command\n"
+					}
+					conn.Write([]byte(res))
+				}
+			}(conn)
+		}
+	}()
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func newAdmin(t *testing.T) (*Admin, func()) {
+	addr, closer := fakeServer(t)
+	admin, err := New(Network, addr)
+	if err != nil {
+		closer()
+		t.Fatal(err)
+	}
+	return admin, func() {
+		admin.Close()
+		closer()
+	}
+}
+
+func TestAdminStatus(t *testing.T) {
+	admin, closer := newAdmin(t)
+	defer closer()
+	status, err := admin.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*FuncStatus{
+		{Name: "ToUpper", Queued: 2, Running: 1, Workers: 3},
+		{Name: "SysInfo", Queued: 0, Running: 0, Workers: 1},
+	}
+	if !reflect.DeepEqual(expected, status) {
+		t.Errorf("%+v expected, %+v got.", expected, status)
+	}
+}
+
+func TestAdminWorkers(t *testing.T) {
+	admin, closer := newAdmin(t)
+	defer closer()
+	workers, err := admin.Workers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*WorkerStatus{
+		{Fd: 33, Ip: "127.0.0.1", ClientId: "-",
+			Funcs: []string{"ToUpper", "SysInfo"}},
+		{Fd: 34, Ip: "::1", ClientId: "worker-1", Funcs: []string{}},
+	}
+	if !reflect.DeepEqual(expected, workers) {
+		t.Errorf("%+v expected, %+v got.", expected, workers)
+	}
+}
+
+func TestAdminCommands(t *testing.T) {
+	admin, closer := newAdmin(t)
+	defer closer()
+	if err := admin.MaxQueue("ToUpper", 10); err != nil {
+		t.Error(err)
+	}
+	if err := admin.MaxQueue("ToUpper", -1); err != nil {
+		t.Error(err)
+	}
+	if v, err := admin.Version(); err != nil || v != "1.1.19" {
+		t.Errorf("Version: %q, %v", v, err)
+	}
+	if pid, err := admin.GetPid(); err != nil || pid != 4242 {
+		t.Errorf("GetPid: %d, %v", pid, err)
+	}
+	if err := admin.Shutdown(true); err != nil {
+		t.Error(err)
+	}
+	if err := admin.CancelJob("H:lap:1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAdminErrors(t *testing.T) {
+	admin, closer := newAdmin(t)
+	defer closer()
+	err := admin.CancelJob("H:lap:2")
+	if e, ok := err.(*ServerError); !ok {
+		t.Errorf("ServerError expected, %v got.", err)
+	} else if e.Code != "UNKNOWN_JOB" || e.Message != "Unknown job" {
+		t.Errorf("Unexpected error: %+v", e)
+	}
+	// the connection is still usable after an error
+	if _, err := admin.Version(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := parseStatus([]string{"ToUpper\t2\t1"}); err == nil {
+		t.Error("ParseError expected")
+	} else if _, ok := err.(*ParseError); !ok {
+		t.Errorf("ParseError expected, %v got.", err)
+	}
+	if _, err := parseStatus([]string{"ToUpper\t2\tx\t1"}); err == nil {
+		t.Error("ParseError expected")
+	}
+	if _, err := parseWorkers([]string{"33 127.0.0.1 - ToUpper"}); err == nil {
+		t.Error("ParseError expected")
+	}
+	if _, err := parseWorkers([]string{"x 127.0.0.1 - :"}); err == nil {
+		t.Error("ParseError expected")
+	}
+}
@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrLostConn = errors.New("Lost connection with Gearmand")
+)
+
+// ServerError is an "ERR" line sent back by the job server.
+type ServerError struct {
+	Code, Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// ParseError is returned when a line of a response can't be parsed.
+type ParseError struct {
+	Command string // the command which was sent
+	Line    string // the offending line
+	Reason  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Invalid response to %q: %s: %q",
+		e.Command, e.Reason, e.Line)
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"math/rand"
+	"time"
+)
+
+var (
+	// DefaultBackoff is used to reconnect unless WithBackoff is given.
+	DefaultBackoff = Backoff{
+		Initial:    100 * time.Millisecond,
+		Max:        30 * time.Second,
+		Multiplier: 2,
+		Jitter:     0.2,
+	}
+)
+
+// Backoff is an exponential backoff policy.
+type Backoff struct {
+	Initial     time.Duration // delay before the first attempt
+	Max         time.Duration // delays never grow over Max
+	Multiplier  float64       // each delay is Multiplier times the last one
+	Jitter      float64       // delays are randomized by up to this fraction
+	MaxAttempts int           // give up after MaxAttempts, 0 never gives up
+}
+
+// Delay returns how long to wait before the attempt, counted from 1.
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Initial)
+	for i := 1; i < attempt && (b.Max <= 0 || d < float64(b.Max)); i++ {
+		d *= b.Multiplier
+	}
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// giveUp tells if there should be no attempt after the attempt.
+func (b Backoff) giveUp(attempt int) bool {
+	return b.MaxAttempts > 0 && attempt >= b.MaxAttempts
+}
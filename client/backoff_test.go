@@ -0,0 +1,36 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{
+		Initial:    100 * time.Millisecond,
+		Max:        time.Second,
+		Multiplier: 2,
+	}
+	cases := map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	}
+	for attempt, expected := range cases {
+		if d := b.Delay(attempt); d != expected {
+			t.Errorf("%d: %v expected, %v got.", attempt, expected, d)
+		}
+	}
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := b.Delay(2); d < 100*time.Millisecond || d > 300*time.Millisecond {
+			t.Errorf("%v out of jitter.", d)
+		}
+	}
+	b.MaxAttempts = 3
+	if b.giveUp(2) || !b.giveUp(3) {
+		t.Error("Should give up after 3 attempts.")
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+// JobSpec is a job of a batch, see (*Client).DoBatch.
+type JobSpec struct {
+	Funcname string
+	Data     []byte
+	// Id is the unique ID of the job, a new one is taken from the
+	// client's generator when empty.
+	Id string
+	// Flag can be set to: JobLow, JobNormal and JobHigh
+	Flag       byte
+	Background bool
+	// Handler gets the responses of a foreground job, it can be nil.
+	Handler ResponseHandler
+}
+
+// BatchResult is the outcome of submitting a JobSpec.
+type BatchResult struct {
+	Handle string
+	Err    error
+}
+
+// DoBatch submits all the jobs with one flush and waits for them to
+// be created, or until ctx is done. The results are in the order of
+// jobs. If a job waits for a Limiter, the jobs before it are flushed
+// first.
+func (client *Client) DoBatch(ctx context.Context,
+	jobs []JobSpec) (results []BatchResult) {
+	results = make([]BatchResult, len(jobs))
+	subs := make([]*submission, len(jobs))
+	releases := make([]func(), len(jobs))
+	jobs = append([]JobSpec(nil), jobs...)
+	written := 0
+	flush := func(end int) {
+		client.wmutex.Lock()
+		err := client.writeBatch(jobs[written:end], subs[written:end],
+			results[written:end])
+		client.wmutex.Unlock()
+		if err != nil {
+			for i := written; i < end; i++ {
+				if subs[i] != nil {
+					client.submits.remove(subs[i])
+					subs[i] = nil
+				}
+				if results[i].Err == nil {
+					results[i].Err = err
+				}
+			}
+		}
+		written = end
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Background {
+			job.Handler = nil
+		}
+		releases[i], job.Handler, results[i].Err = client.limit(ctx,
+			job.Funcname, !job.Background, job.Handler, func() { flush(i) })
+	}
+	flush(len(jobs))
+	for i, s := range subs {
+		if s != nil {
+			results[i].Handle, results[i].Err = client.wait(ctx, s)
+		}
+		if results[i].Err != nil {
+			releases[i]()
+		}
+	}
+	return
+}
+
+// writeBatch queues and writes the jobs, but the ones with an error
+// already. The caller holds wmutex.
+func (client *Client) writeBatch(jobs []JobSpec, subs []*submission,
+	results []BatchResult) (err error) {
+	var reqs []*protocol.Packet
+	for i, job := range jobs {
+		if results[i].Err != nil {
+			continue
+		}
+		id := job.Id
+		if id == "" {
+			id = client.id(job.Funcname, job.Data)
+		}
+		var req = getJob(jobType(job.Flag), id, []byte(job.Funcname), job.Data)
+		if job.Background {
+			req.Type = bgJobType(job.Flag)
+		}
+		subs[i] = &submission{job: client.newJob(req, job.Handler),
+			result: make(chan handleOrError, 1), gen: client.gen}
+		client.submits.push(subs[i])
+		reqs = append(reqs, req)
+	}
+	return client.writeLocked(reqs...)
+}
+
+// DoBatch submits all the jobs to one selected server.
+func (pool *Pool) DoBatch(ctx context.Context,
+	jobs []JobSpec) (addr string, results []BatchResult) {
+	client := pool.selectServer()
+	results = client.DoBatch(ctx, jobs)
+	addr = client.addr
+	return
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+type countingConn struct {
+	net.Conn
+	writes *int32
+}
+
+func (c countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt32(c.writes, 1)
+	return c.Conn.Write(b)
+}
+
+func TestClientDoBatch(t *testing.T) {
+	const n = 100
+	// every job is created but the last one
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if string(req.Arg(1)) == fmt.Sprint(n-1) {
+			return
+		}
+		expected := protocol.SubmitJobHighBg
+		if req.Arg(1)[0]%2 == 0 {
+			expected = protocol.SubmitJobHigh
+		}
+		if req.Type != expected {
+			t.Errorf("%s expected, %s got.", expected, req.Type)
+		}
+		writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated,
+			append([]byte("H:"), req.Arg(1)...)))
+	})
+	defer srv.close()
+	var writes int32
+	c, err := New(Network, srv.addr(),
+		WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			return countingConn{conn, &writes}, err
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	jobs := make([]JobSpec, n)
+	for i := range jobs {
+		jobs[i] = JobSpec{
+			Funcname:   "batch",
+			Data:       []byte(TestStr),
+			Id:         fmt.Sprint(i),
+			Flag:       JobHigh,
+			Background: fmt.Sprint(i)[0]%2 != 0,
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	results := c.DoBatch(ctx, jobs)
+	if w := atomic.LoadInt32(&writes); w != 1 {
+		t.Errorf("%d write expected, %d got.", 1, w)
+	}
+	for i, r := range results[:n-1] {
+		if r.Err != nil || r.Handle != fmt.Sprintf("H:%d", i) {
+			t.Errorf("%d: H:%d expected, %s %v got.", i, i, r.Handle, r.Err)
+		}
+	}
+	if r := results[n-1]; r.Err != context.DeadlineExceeded {
+		t.Errorf("%v expected, %v got.", context.DeadlineExceeded, r.Err)
+	}
+}
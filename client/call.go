@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+// WorkError is the error a Call ends with when the worker fails the
+// job or throws an exception. Err is ErrWorkFail or ErrWorkException.
+type WorkError struct {
+	Handle string
+	Err    error
+	Data   []byte // the exception, if any
+}
+
+func (e *WorkError) Error() string {
+	if e.Data == nil {
+		return fmt.Sprintf("%s: %s", e.Err, e.Handle)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Err, e.Handle, e.Data)
+}
+
+func (e *WorkError) Unwrap() error {
+	return e.Err
+}
+
+// Call is a foreground job submitted by (*Client).Call. It collects
+// everything the worker sends until the job is done.
+type Call struct {
+	Handle string
+
+	mutex                  sync.Mutex
+	chunks                 [][]byte
+	warnings               [][]byte
+	numerator, denominator uint64
+
+	result []byte
+	err    error
+	done   chan struct{}
+
+	// judge looks at the last response while it is valid, see
+	// RetryPolicy.Retry.
+	judge  func(*Response) bool
+	judged bool
+}
+
+func newCall() *Call {
+	return &Call{done: make(chan struct{})}
+}
+
+// handle is the ResponseHandler of the call. The responses are
+// pooled, so everything kept is copied.
+func (call *Call) handle(resp *Response) {
+	call.mutex.Lock()
+	defer call.mutex.Unlock()
+	if call.judge != nil && resp.err == nil {
+		switch resp.DataType {
+		case protocol.WorkComplete, protocol.WorkFail, protocol.WorkException:
+			call.judged = call.judge(resp)
+		}
+	}
+	switch resp.DataType {
+	case protocol.WorkData:
+		call.chunks = append(call.chunks, append([]byte(nil), resp.Data...))
+	case protocol.WorkWarning:
+		call.warnings = append(call.warnings, append([]byte(nil), resp.Data...))
+	case protocol.WorkStatus:
+		if status, err := resp.Status(); err == nil {
+			call.numerator, call.denominator = status.Numerator, status.Denominator
+		}
+	case protocol.WorkComplete:
+		call.result = append([]byte{}, resp.Data...)
+		close(call.done)
+	case protocol.WorkFail, protocol.WorkException:
+		call.err = workError(resp)
+		close(call.done)
+	}
+}
+
+// workError is the error of a failed job, or the error of the
+// connection.
+func workError(resp *Response) error {
+	if resp.err != nil {
+		return resp.err
+	}
+	if resp.DataType == protocol.WorkException {
+		return &WorkError{Handle: resp.Handle, Err: ErrWorkException,
+			Data: append([]byte{}, resp.Data...)}
+	}
+	return &WorkError{Handle: resp.Handle, Err: ErrWorkFail}
+}
+
+// Done is closed when the job is complete, failed or threw an
+// exception.
+func (call *Call) Done() <-chan struct{} {
+	return call.done
+}
+
+// Wait waits until the job is done and returns its result, or a
+// *WorkError if it failed, or a *LostConnError. If ctx is done first, Wait returns the
+// context error; the job itself goes on and can be waited for again.
+func (call *Call) Wait(ctx context.Context) (data []byte, err error) {
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	call.mutex.Lock()
+	defer call.mutex.Unlock()
+	return call.result, call.err
+}
+
+// Chunks returns the WORK_DATA sent so far, in order.
+func (call *Call) Chunks() [][]byte {
+	call.mutex.Lock()
+	defer call.mutex.Unlock()
+	return append([][]byte(nil), call.chunks...)
+}
+
+// Warnings returns the WORK_WARNING sent so far, in order.
+func (call *Call) Warnings() [][]byte {
+	call.mutex.Lock()
+	defer call.mutex.Unlock()
+	return append([][]byte(nil), call.warnings...)
+}
+
+// Status returns the last WORK_STATUS sent.
+func (call *Call) Status() (numerator, denominator uint64) {
+	call.mutex.Lock()
+	defer call.mutex.Unlock()
+	return call.numerator, call.denominator
+}
+
+// Call the function and return once the job is created, Wait for
+// the result. ctx bounds the submission only.
+// flag can be set to: JobLow, JobNormal and JobHigh
+func (client *Client) Call(ctx context.Context, funcname string,
+	data []byte, flag byte) (call *Call, err error) {
+	call, err = client.CallWithId(ctx, funcname, data, flag, client.id(funcname, data))
+	return
+}
+
+// Call the function and return once the job is created, Wait for
+// the result.
+func (client *Client) CallWithId(ctx context.Context, funcname string,
+	data []byte, flag byte, id string) (call *Call, err error) {
+	return client.callWithId(ctx, funcname, data, flag, id, nil)
+}
+
+func (client *Client) callWithId(ctx context.Context, funcname string,
+	data []byte, flag byte, id string,
+	judge func(*Response) bool) (call *Call, err error) {
+	if len(id) == 0 {
+		return nil, ErrInvalidId
+	}
+	call = newCall()
+	call.judge = judge
+	req := getJob(jobType(flag), id, []byte(funcname), data)
+	if call.Handle, err = client.submit(ctx, req, call.handle); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Call the function on a selected server, Wait for the result.
+func (pool *Pool) Call(ctx context.Context, funcname string,
+	data []byte, flag byte) (addr string, call *Call, err error) {
+	client := pool.selectServer()
+	call, err = client.Call(ctx, funcname, data, flag)
+	addr = client.addr
+	return
+}
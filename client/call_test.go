@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+func TestClientCall(t *testing.T) {
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.SubmitJob {
+			return
+		}
+		h := []byte("H:" + string(req.Arg(0)))
+		packets := []*protocol.Packet{
+			protocol.NewResponse(protocol.JobCreated, h),
+			protocol.NewResponse(protocol.WorkStatus, h, []byte("1"), []byte("2")),
+			protocol.NewResponse(protocol.WorkData, h, []byte("chunk")),
+			protocol.NewResponse(protocol.WorkWarning, h, []byte("warning")),
+		}
+		switch string(req.Arg(0)) {
+		case "fail":
+			packets = append(packets, protocol.NewResponse(protocol.WorkFail, h))
+		case "exception":
+			packets = append(packets,
+				protocol.NewResponse(protocol.WorkException, h, []byte("oops")))
+		default:
+			packets = append(packets,
+				protocol.NewResponse(protocol.WorkComplete, h, req.Arg(2)))
+		}
+		writeFragmented(conn, 3, packets...)
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	cases := map[string]error{
+		"complete":  nil,
+		"fail":      ErrWorkFail,
+		"exception": ErrWorkException,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for fn, expected := range cases {
+		call, err := c.Call(ctx, fn, []byte(TestStr), JobNormal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if call.Handle != "H:"+fn {
+			t.Errorf("%s expected, %s got.", "H:"+fn, call.Handle)
+		}
+		data, err := call.Wait(ctx)
+		if !errors.Is(err, expected) {
+			t.Errorf("%s: %v expected, %v got.", fn, expected, err)
+		}
+		if expected == nil && string(data) != TestStr {
+			t.Errorf("%s: %s expected, %s got.", fn, TestStr, data)
+		}
+		if werr, ok := err.(*WorkError); ok {
+			if werr.Handle != call.Handle {
+				t.Errorf("%s: %s expected, %s got.", fn, call.Handle, werr.Handle)
+			}
+			if expected == ErrWorkException && string(werr.Data) != "oops" {
+				t.Errorf("%s: %s expected, %s got.", fn, "oops", werr.Data)
+			}
+		}
+		if chunks := call.Chunks(); len(chunks) != 1 || string(chunks[0]) != "chunk" {
+			t.Errorf("%s: %q expected, %q got.", fn, "chunk", chunks)
+		}
+		if warnings := call.Warnings(); len(warnings) != 1 || string(warnings[0]) != "warning" {
+			t.Errorf("%s: %q expected, %q got.", fn, "warning", warnings)
+		}
+		if n, d := call.Status(); n != 1 || d != 2 {
+			t.Errorf("%s: 1/2 expected, %d/%d got.", fn, n, d)
+		}
+	}
+}
+
+func TestCallWaitContext(t *testing.T) {
+	call := newCall()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := call.Wait(ctx); err != context.Canceled {
+		t.Errorf("%v expected, %v got.", context.Canceled, err)
+	}
+}
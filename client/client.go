@@ -4,9 +4,14 @@ package client
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
 	"net"
 	"sync"
 	"time"
+
+	"github.com/mikespook/gearman-go/internal/transport"
+	"github.com/mikespook/gearman-go/protocol"
 )
 
 var (
@@ -18,180 +23,447 @@ var (
 type Client struct {
 	sync.Mutex
 
-	net, addr    string
-	innerHandler *responseHandlerMap
-	in           chan *Response
-	conn         net.Conn
-	rw           *bufio.ReadWriter
+	net, addr string
+	submits   *submitQueue
+	jobs      *jobMap // foreground jobs in flight
+	in        chan *Response
+	conn      net.Conn
+	rw        *bufio.ReadWriter
+	gen       int        // counts the connections made
+	wmutex    sync.Mutex // guards conn, rw and gen, serializes writes
+	closed    chan struct{}
+	backoff   Backoff
 
 	ResponseTimeout time.Duration // response timeout for do()
 
 	ErrorHandler ErrorHandler
+
+	serverOptions []string
+	connHandler   ConnHandler
+	tlsConfig     *tls.Config
+	dialer        DialFunc
+	idGen         IdGenerator
+	clientId      string
+	limiter       *Limiter
+
+	connectTimeout, readTimeout, writeTimeout time.Duration
+	readBufferSize, writeBufferSize           int
+	streamBuffer, maxPacketSize               int
+	streamBackpressure                        bool
 }
 
-type responseHandlerMap struct {
+// submitQueue holds the requests waiting for an answer, in the
+// order they were written: the submissions waiting for JOB_CREATED
+// and the round trips. The job server answers them in the same order.
+type submitQueue struct {
 	sync.Mutex
-	holder map[string]handledResponse
+	pending []*submission
 }
 
-type handledResponse struct {
-	internal ResponseHandler // internal handler, always non-nil
-	external ResponseHandler // handler passed in from (*Client).Do, sometimes nil
+type submission struct {
+	key       string          // what answers it, empty for JOB_CREATED
+	h         ResponseHandler // gets the answer of a round trip
+	job       *job            // nil for background jobs
+	result    chan handleOrError
+	gen       int // the connection it was written to
+	abandoned bool
 }
 
-func newResponseHandlerMap() *responseHandlerMap {
-	return &responseHandlerMap{holder: make(map[string]handledResponse, queueSize)}
+func (q *submitQueue) push(s *submission) {
+	q.Lock()
+	q.pending = append(q.pending, s)
+	q.Unlock()
 }
 
-func (r *responseHandlerMap) remove(key string) {
-	r.Lock()
-	delete(r.holder, key)
-	r.Unlock()
+// pop returns the oldest request, it is nil if the requester has
+// given up waiting.
+func (q *submitQueue) pop() (s *submission, ok bool) {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.pending) == 0 {
+		return nil, false
+	}
+	s = q.pending[0]
+	q.pending[0] = nil
+	q.pending = q.pending[1:]
+	if s.abandoned {
+		return nil, true
+	}
+	return s, true
 }
 
-func (r *responseHandlerMap) getAndRemove(key string) (handledResponse, bool) {
-	r.Lock()
-	rh, b := r.holder[key]
-	delete(r.holder, key)
-	r.Unlock()
-	return rh, b
+func (q *submitQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.pending)
 }
 
-func (r *responseHandlerMap) putWithExternalHandler(key string, internal, external ResponseHandler) {
-	r.Lock()
-	r.holder[key] = handledResponse{internal: internal, external: external}
-	r.Unlock()
+// take returns the oldest request answered by key, it is nil if the
+// requester has given up waiting.
+func (q *submitQueue) take(key string) (s *submission, ok bool) {
+	q.Lock()
+	defer q.Unlock()
+	for i, p := range q.pending {
+		if p.key == key {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			if p.abandoned {
+				return nil, true
+			}
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// abandon marks s as given up. It returns false when s was already
+// answered.
+func (q *submitQueue) abandon(s *submission) bool {
+	q.Lock()
+	defer q.Unlock()
+	for _, p := range q.pending {
+		if p == s {
+			s.abandoned = true
+			return true
+		}
+	}
+	return false
+}
+
+// remove drops s if it was never written.
+func (q *submitQueue) remove(s *submission) {
+	q.Lock()
+	defer q.Unlock()
+	for i, p := range q.pending {
+		if p == s {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return
+		}
+	}
 }
 
-func (r *responseHandlerMap) put(key string, rh ResponseHandler) {
-	r.putWithExternalHandler(key, rh, nil)
+// fail answers the pending submissions written to the connection
+// gen, or before, with err.
+func (q *submitQueue) fail(err error, gen int) {
+	q.Lock()
+	defer q.Unlock()
+	i := 0
+	for ; i < len(q.pending) && q.pending[i].gen <= gen; i++ {
+		if !q.pending[i].abandoned {
+			q.pending[i].result <- handleOrError{"", err}
+		}
+		q.pending[i] = nil
+	}
+	q.pending = q.pending[i:]
 }
 
 // New returns a client.
-func New(network, addr string) (client *Client, err error) {
+func New(network, addr string, opts ...Option) (client *Client, err error) {
 	client = &Client{
 		net:             network,
 		addr:            addr,
-		innerHandler:    newResponseHandlerMap(),
+		submits:         &submitQueue{},
+		jobs:            newJobMap(),
 		in:              make(chan *Response, queueSize),
+		closed:          make(chan struct{}),
+		backoff:         DefaultBackoff,
+		readBufferSize:  bufferSize,
+		writeBufferSize: bufferSize,
+		streamBuffer:    DefaultStreamBuffer,
+		maxPacketSize:   protocol.DefaultMaxSize,
 		ResponseTimeout: DefaultTimeout,
 	}
-	client.conn, err = net.Dial(client.net, client.addr)
-	if err != nil {
+	for _, opt := range opts {
+		opt(client)
+	}
+	var rw *bufio.ReadWriter
+	if rw, err = client.connect(nil); err != nil {
 		return
 	}
-	client.rw = bufio.NewReadWriter(bufio.NewReader(client.conn),
-		bufio.NewWriter(client.conn))
-	go client.readLoop()
+	go client.readLoop(rw)
 	go client.processLoop()
+	for _, name := range client.serverOptions {
+		if err = client.optionReq(name); err != nil {
+			client.Close()
+			return
+		}
+	}
 	return
 }
 
-func (client *Client) write(req *request) (err error) {
-	var n int
-	buf := req.Encode()
-	for i := 0; i < len(buf); i += n {
-		n, err = client.rw.Write(buf[i:])
-		if err != nil {
-			return
+// connect dials the job server and makes it the client's connection.
+// The server options are asked for before anything else is written.
+func (client *Client) connect(options []string) (rw *bufio.ReadWriter, err error) {
+	client.event(StateConnecting, 0, nil)
+	var conn net.Conn
+	if conn, err = client.dial(); err != nil {
+		return
+	}
+	client.wmutex.Lock()
+	select {
+	case <-client.closed:
+		client.wmutex.Unlock()
+		conn.Close()
+		return nil, ErrLostConn
+	default:
+	}
+	client.conn = conn
+	client.rw = bufio.NewReadWriter(bufio.NewReaderSize(conn, client.readBufferSize),
+		bufio.NewWriterSize(conn, client.writeBufferSize))
+	client.gen++
+	rw = client.rw
+	var reqs []*protocol.Packet
+	if client.clientId != "" {
+		reqs = append(reqs, getRequest(protocol.SetClientId, []byte(client.clientId)))
+	}
+	for _, name := range options {
+		// nobody waits for the answer
+		client.submits.push(&submission{key: "o", gen: client.gen, abandoned: true})
+		reqs = append(reqs, getRequest(protocol.OptionReq, []byte(name)))
+	}
+	if len(reqs) > 0 {
+		err = client.writeLocked(reqs...)
+	}
+	client.wmutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	client.event(StateConnected, 0, nil)
+	return
+}
+
+// dial connects to the job server.
+func (client *Client) dial() (net.Conn, error) {
+	d := transport.Dialer{
+		Dial:           client.dialer,
+		TLS:            client.tlsConfig,
+		ConnectTimeout: client.connectTimeout,
+		ReadTimeout:    client.readTimeout,
+		WriteTimeout:   client.writeTimeout,
+	}
+	return d.Connect(client.net, client.addr)
+}
+
+// id returns a new unique ID of the job from the client's generator.
+func (client *Client) id(funcname string, data []byte) string {
+	if client.idGen != nil {
+		return contentId(client.idGen, funcname, data)
+	}
+	return contentId(IdGen, funcname, data)
+}
+
+// disconnect drops the broken connection. It returns the generation
+// of the connection and whether the client has been closed.
+func (client *Client) disconnect() (gen int, closed bool) {
+	client.wmutex.Lock()
+	defer client.wmutex.Unlock()
+	if client.conn != nil {
+		client.conn.Close()
+		client.conn = nil
+	}
+	select {
+	case <-client.closed:
+		closed = true
+	default:
+	}
+	return client.gen, closed
+}
+
+// reconnect dials the job server again, waiting longer after every
+// failure as the backoff says. It is false when the client has been
+// closed or the backoff gives up.
+func (client *Client) reconnect(cause error) (rw *bufio.ReadWriter, ok bool) {
+	err := cause
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(client.backoff.Delay(attempt)):
+		case <-client.closed:
+			return nil, false
+		}
+		client.event(StateReconnecting, attempt, err)
+		// server options are per connection, ask for them again
+		client.Lock()
+		names := append([]string(nil), client.serverOptions...)
+		client.Unlock()
+		if rw, err = client.connect(names); err == nil {
+			return rw, true
+		}
+		client.err(err)
+		if client.backoff.giveUp(attempt) {
+			return nil, false
 		}
 	}
-	return client.rw.Flush()
 }
 
-func (client *Client) read(length int) (data []byte, err error) {
-	n := 0
-	buf := getBuffer(bufferSize)
-	// read until data can be unpacked
-	for i := length; i > 0 || len(data) < minPacketLength; i -= n {
-		if n, err = client.rw.Read(buf); err != nil {
-			return
+// keepalive sends an ECHO_REQ if no answer is outstanding, so the
+// read timeout tells an idle connection from a lost one. It is false
+// if an answer is overdue.
+func (client *Client) keepalive() bool {
+	client.wmutex.Lock()
+	defer client.wmutex.Unlock()
+	if client.submits.len() > 0 {
+		return false
+	}
+	// nobody waits for the answer
+	s := &submission{key: "e", gen: client.gen, abandoned: true}
+	client.submits.push(s)
+	if err := client.writeLocked(getRequest(protocol.EchoReq, nil)); err != nil {
+		client.submits.remove(s)
+		return false
+	}
+	return true
+}
+
+// write sends the request and puts it back to the pool.
+func (client *Client) write(req *protocol.Packet) (err error) {
+	client.wmutex.Lock()
+	defer client.wmutex.Unlock()
+	return client.writeLocked(req)
+}
+
+// writeLocked writes the requests with one flush and puts them back
+// to the pool, the caller holds wmutex.
+func (client *Client) writeLocked(reqs ...*protocol.Packet) (err error) {
+	defer func() {
+		for _, req := range reqs {
+			req.Release()
 		}
-		data = append(data, buf[0:n]...)
-		if n < bufferSize {
+	}()
+	if client.conn == nil {
+		return ErrLostConn
+	}
+	for _, req := range reqs {
+		if _, err = req.WriteTo(client.rw); err != nil {
 			break
 		}
 	}
+	if err == nil {
+		err = client.rw.Flush()
+	}
+	if err != nil {
+		// The writer is broken for good, let the read loop
+		// reconnect.
+		client.conn.Close()
+	}
 	return
 }
 
-func (client *Client) readLoop() {
+func (client *Client) readLoop(rw *bufio.ReadWriter) {
 	defer close(client.in)
-	var data, leftdata []byte
-	var err error
-	var resp *Response
-ReadLoop:
-	for client.conn != nil {
-		if data, err = client.read(bufferSize); err != nil {
-			if opErr, ok := err.(*net.OpError); ok {
-				if opErr.Timeout() {
-					client.err(err)
-				}
-				if opErr.Temporary() {
-					continue
-				}
-				break
-			}
+	// A packet is read as a header and a body of the length given in
+	// the header, however the stream is fragmented.
+	dec := client.newDecoder(rw)
+	for {
+		// The read timeout between two packets is idle time, unless
+		// an answer is overdue.
+		_, err := rw.Peek(1)
+		if transport.IsTimeout(err) && client.keepalive() {
+			continue
+		}
+		var p *protocol.Packet
+		if err == nil {
+			p, err = dec.Decode()
+		}
+		if err == nil {
+			client.in <- newResponse(p)
+			continue
+		}
+		if _, ok := err.(*protocol.ArgsError); ok {
+			// The whole packet was read, just skip it.
 			client.err(err)
-			// If it is unexpected error and the connection wasn't
-			// closed by Gearmand, the client should close the conection
-			// and reconnect to job server.
-			client.Close()
-			client.conn, err = net.Dial(client.net, client.addr)
-			if err != nil {
-				client.err(err)
-				break
-			}
-			client.rw = bufio.NewReadWriter(bufio.NewReader(client.conn),
-				bufio.NewWriter(client.conn))
 			continue
 		}
-		if len(leftdata) > 0 { // some data left for processing
-			data = append(leftdata, data...)
-			leftdata = nil
+		if e, ok := err.(*protocol.SizeError); ok && jobPacket(e.Type) {
+			// The packet was skipped, its jobs fail with e.
+			client.err(err)
+			client.in <- tooLargeResponse(e)
+			continue
 		}
-		for {
-			l := len(data)
-			if l < minPacketLength { // not enough data
-				leftdata = data
-				continue ReadLoop
-			}
-			if resp, l, err = decodeResponse(data); err != nil {
-				leftdata = data[l:]
-				continue ReadLoop
-			} else {
-				client.in <- resp
-			}
-			data = data[l:]
-			if len(data) > 0 {
-				continue
-			}
-			break
+		// A timeout within a packet is a lost connection.
+		if opErr, ok := err.(*net.OpError); ok && opErr.Temporary() &&
+			!opErr.Timeout() {
+			continue
+		}
+		// Everything outstanding on the connection is lost with it,
+		// the job server doesn't know this client after reconnecting.
+		gen, closed := client.disconnect()
+		lost := &LostConnError{Addr: client.addr, Err: err}
+		client.in <- lostResponse(lost, gen)
+		if closed {
+			return
+		}
+		client.event(StateDisconnected, 0, err)
+		client.err(err)
+		var ok bool
+		if rw, ok = client.reconnect(err); !ok {
+			client.Close()
+			return
 		}
+		dec = client.newDecoder(rw)
 	}
 }
 
+func (client *Client) newDecoder(rw *bufio.ReadWriter) *protocol.Decoder {
+	dec := protocol.NewDecoder(rw)
+	dec.MaxSize = client.maxPacketSize
+	return dec
+}
+
 func (client *Client) processLoop() {
-	rhandlers := map[string]ResponseHandler{}
 	for resp := range client.in {
-		switch resp.DataType {
-		case dtError:
+		if _, ok := resp.err.(*LostConnError); ok {
+			client.lose(resp.err, resp.gen)
+		} else {
+			client.process(resp)
+		}
+		// Handlers must not keep resp.Data, see Response.
+		resp.release()
+	}
+}
+
+// lose tells the submissions and the jobs of the connection gen, or
+// before, that the connection is lost.
+func (client *Client) lose(err error, gen int) {
+	client.submits.fail(err, gen)
+	for _, j := range client.jobs.removeAll() {
+		j.fail(err)
+	}
+}
+
+func (client *Client) process(resp *Response) {
+	switch resp.DataType {
+	case protocol.Error:
+		// ERROR answers the oldest request, eg. a submission when
+		// the queue is full or an OPTION_REQ of an unknown option.
+		if s, ok := client.submits.pop(); !ok {
 			client.err(getError(resp.Data))
-		case dtStatusRes:
-			client.handleInner("s"+resp.Handle, resp, nil)
-		case dtJobCreated:
-			client.handleInner("c", resp, rhandlers)
-		case dtEchoRes:
-			client.handleInner("e", resp, nil)
-		case dtWorkData, dtWorkWarning, dtWorkStatus:
-			if cb := rhandlers[resp.Handle]; cb != nil {
-				cb(resp)
-			}
-		case dtWorkComplete, dtWorkFail, dtWorkException:
-			if cb := rhandlers[resp.Handle]; cb != nil {
-				cb(resp)
-				delete(rhandlers, resp.Handle)
+		} else if s != nil {
+			s.result <- handleOrError{"", getError(resp.Data)}
+		}
+	case protocol.OptionRes:
+		client.answer("o", resp)
+	case protocol.StatusRes:
+		client.answer("s"+resp.Handle, resp)
+	case protocol.StatusResUnique:
+		client.answer("u"+string(resp.UID), resp)
+	case protocol.JobCreated:
+		if s, ok := client.submits.take(""); ok && s != nil {
+			if s.job != nil {
+				s.job.info.Handle = resp.Handle
+				client.jobs.put(s.job)
 			}
+			s.result <- handleOrError{resp.Handle, nil}
+		}
+	case protocol.EchoRes:
+		client.answer("e", resp)
+	case protocol.WorkData, protocol.WorkWarning, protocol.WorkStatus:
+		for _, j := range client.jobs.get(resp) {
+			j.handle(resp)
+		}
+	case protocol.WorkComplete, protocol.WorkFail, protocol.WorkException:
+		// a repeated one finds no job, nor one after a packet too
+		// large
+		for _, j := range client.jobs.remove(resp.Handle) {
+			j.handle(resp)
 		}
 	}
 }
@@ -202,13 +474,15 @@ func (client *Client) err(e error) {
 	}
 }
 
-func (client *Client) handleInner(key string, resp *Response, rhandlers map[string]ResponseHandler) {
-	if h, ok := client.innerHandler.getAndRemove(key); ok {
-		if h.external != nil && resp.Handle != "" {
-			rhandlers[resp.Handle] = h.external
-		}
-		h.internal(resp)
+// answer passes resp to the oldest round trip waiting for key. It is
+// false if there is none.
+func (client *Client) answer(key string, resp *Response) bool {
+	s, ok := client.submits.take(key)
+	if ok && s != nil {
+		s.h(resp)
+		s.result <- handleOrError{}
 	}
+	return ok
 }
 
 type handleOrError struct {
@@ -217,39 +491,97 @@ type handleOrError struct {
 }
 
 func (client *Client) do(funcname string, data []byte,
-	flag uint32, h ResponseHandler, id string) (handle string, err error) {
+	datatype protocol.PacketType, h ResponseHandler, id string) (handle string, err error) {
 	if len(id) == 0 {
 		return "", ErrInvalidId
 	}
-	if client.conn == nil {
-		return "", ErrLostConn
+	req := getJob(datatype, id, []byte(funcname), data)
+	return client.submitTimeout(req, h)
+}
+
+// submitTimeout is submit bounded by ResponseTimeout, as the calls
+// without a context have always been.
+func (client *Client) submitTimeout(req *protocol.Packet,
+	h ResponseHandler) (handle string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), client.ResponseTimeout)
+	defer cancel()
+	if handle, err = client.submit(ctx, req, h); err == context.DeadlineExceeded {
+		err = ErrLostConn
 	}
-	var result = make(chan handleOrError, 1)
-	client.Lock()
-	defer client.Unlock()
-	client.innerHandler.putWithExternalHandler("c", func(resp *Response) {
-		if resp.DataType == dtError {
-			err = getError(resp.Data)
-			result <- handleOrError{"", err}
-			return
+	return
+}
+
+// submit writes a SUBMIT_JOB* request and waits for its JOB_CREATED,
+// or until ctx is done. Submissions are pipelined, the JOB_CREATED
+// are matched to them in order. An ERROR answer, eg. when the queue
+// of the function is full, is returned as the error.
+func (client *Client) submit(ctx context.Context, req *protocol.Packet,
+	h ResponseHandler) (handle string, err error) {
+	handle, _, err = client.submitJob(ctx, req, h)
+	return
+}
+
+// submitJob is submit also returning the job in flight, nil for a
+// background request.
+func (client *Client) submitJob(ctx context.Context, req *protocol.Packet,
+	h ResponseHandler) (handle string, j *job, err error) {
+	release, h, err := client.limit(ctx, string(req.Arg(0)), foreground(req.Type), h, nil)
+	if err != nil {
+		req.Release()
+		return
+	}
+	defer func() {
+		if err != nil {
+			release()
 		}
-		handle = resp.Handle
-		result <- handleOrError{handle, nil}
-	}, h)
-	req := getJob(id, []byte(funcname), data)
-	req.DataType = flag
-	if err = client.write(req); err != nil {
-		client.innerHandler.remove("c")
+	}()
+	s := &submission{job: client.newJob(req, h),
+		result: make(chan handleOrError, 1)}
+	if err = client.send(s, req); err != nil {
 		return
 	}
-	var timer = time.After(client.ResponseTimeout)
+	handle, err = client.wait(ctx, s)
+	return handle, s.job, err
+}
+
+// send queues s and writes its request, in the same order.
+func (client *Client) send(s *submission, req *protocol.Packet) (err error) {
+	client.wmutex.Lock()
+	defer client.wmutex.Unlock()
+	s.gen = client.gen
+	client.submits.push(s)
+	if err = client.writeLocked(req); err != nil {
+		client.submits.remove(s)
+	}
+	return
+}
+
+// wait waits for the JOB_CREATED of s, or until ctx is done.
+func (client *Client) wait(ctx context.Context, s *submission) (handle string, err error) {
 	select {
-	case ret := <-result:
+	case ret := <-s.result:
 		return ret.handle, ret.err
-	case <-timer:
-		client.innerHandler.remove("c")
-		return "", ErrLostConn
+	case <-ctx.Done():
+		if !client.submits.abandon(s) {
+			// answered meanwhile
+			ret := <-s.result
+			return ret.handle, ret.err
+		}
+		return "", ctx.Err()
 	}
+}
+
+// roundTrip writes req and waits until its answer, the response
+// under key, has been passed to h, or until ctx is done. h runs in the
+// process loop. Concurrent round trips under the same key are
+// answered in order. An ERROR answer is returned as the error.
+func (client *Client) roundTrip(ctx context.Context, key string,
+	req *protocol.Packet, h ResponseHandler) (err error) {
+	s := &submission{key: key, h: h, result: make(chan handleOrError, 1)}
+	if err = client.send(s, req); err != nil {
+		return
+	}
+	_, err = client.wait(ctx, s)
 	return
 }
 
@@ -257,7 +589,7 @@ func (client *Client) do(funcname string, data []byte,
 // flag can be set to: JobLow, JobNormal and JobHigh
 func (client *Client) Do(funcname string, data []byte,
 	flag byte, h ResponseHandler) (handle string, err error) {
-	handle, err = client.DoWithId(funcname, data, flag, h, IdGen.Id())
+	handle, err = client.DoWithId(funcname, data, flag, h, client.id(funcname, data))
 	return
 }
 
@@ -265,60 +597,153 @@ func (client *Client) Do(funcname string, data []byte,
 // flag can be set to: JobLow, JobNormal and JobHigh
 func (client *Client) DoBg(funcname string, data []byte,
 	flag byte) (handle string, err error) {
-	handle, err = client.DoBgWithId(funcname, data, flag, IdGen.Id())
+	handle, err = client.DoBgWithId(funcname, data, flag, client.id(funcname, data))
+	return
+}
+
+// DoContext is Do waiting for the job to be created until ctx is
+// done instead of ResponseTimeout. ctx does not bound the job itself,
+// h is still called when it completes.
+func (client *Client) DoContext(ctx context.Context, funcname string,
+	data []byte, flag byte, h ResponseHandler) (handle string, err error) {
+	req := getJob(jobType(flag), client.id(funcname, data), []byte(funcname), data)
+	handle, err = client.submit(ctx, req, h)
+	return
+}
+
+// DoBgContext is DoBg waiting for the job to be created until ctx is
+// done instead of ResponseTimeout.
+func (client *Client) DoBgContext(ctx context.Context, funcname string,
+	data []byte, flag byte) (handle string, err error) {
+	req := getJob(bgJobType(flag), client.id(funcname, data), []byte(funcname), data)
+	handle, err = client.submit(ctx, req, nil)
 	return
 }
 
 // Status gets job status from job server.
 func (client *Client) Status(handle string) (status *Status, err error) {
-	if client.conn == nil {
-		return nil, ErrLostConn
+	return client.StatusContext(context.Background(), handle)
+}
+
+// StatusContext gets job status from job server, giving up when ctx
+// is done.
+func (client *Client) StatusContext(ctx context.Context,
+	handle string) (status *Status, err error) {
+	var s *Status
+	var e error
+	err = client.roundTrip(ctx, "s"+handle,
+		getRequest(protocol.GetStatus, []byte(handle)), func(resp *Response) {
+			s, e = resp._status()
+		})
+	if err != nil {
+		return
 	}
-	var mutex sync.Mutex
-	mutex.Lock()
-	client.innerHandler.put("s"+handle, func(resp *Response) {
-		defer mutex.Unlock()
-		var err error
-		status, err = resp._status()
-		if err != nil {
-			client.err(err)
+	return s, e
+}
+
+// StatusUnique gets job status from job server by the unique ID
+// the job was submitted with. Unlike Status, it also works for jobs
+// submitted through other connections.
+func (client *Client) StatusUnique(id string) (status *Status, err error) {
+	return client.StatusUniqueContext(context.Background(), id)
+}
+
+// StatusUniqueContext is StatusUnique giving up when ctx is done. A
+// job server without GET_STATUS_UNIQUE answers with an error.
+func (client *Client) StatusUniqueContext(ctx context.Context,
+	id string) (status *Status, err error) {
+	if len(id) == 0 {
+		return nil, ErrInvalidId
+	}
+	var s *Status
+	var e error
+	err = client.roundTrip(ctx, "u"+id,
+		getRequest(protocol.GetStatusUnique, []byte(id)), func(resp *Response) {
+			s, e = resp._statusUnique()
+		})
+	if err != nil {
+		return
+	}
+	return s, e
+}
+
+// SetServerOption asks the job server to turn on the option name
+// for this connection, eg. OptionExceptions. The option is requested
+// again whenever the client reconnects.
+func (client *Client) SetServerOption(name string) (err error) {
+	if err = client.optionReq(name); err != nil {
+		return
+	}
+	client.Lock()
+	defer client.Unlock()
+	for _, n := range client.serverOptions {
+		if n == name {
+			return
 		}
-	})
-	req := getRequest()
-	req.DataType = dtGetStatus
-	req.Data = []byte(handle)
-	client.write(req)
-	mutex.Lock()
+	}
+	client.serverOptions = append(client.serverOptions, name)
 	return
 }
 
+func (client *Client) optionReq(name string) (err error) {
+	// one at a time, OPTION_RES only tells the option
+	client.Lock()
+	defer client.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), client.ResponseTimeout)
+	defer cancel()
+	var e error
+	err = client.roundTrip(ctx, "o", getRequest(protocol.OptionReq, []byte(name)),
+		func(resp *Response) {
+			if string(resp.Data) != name {
+				e = ErrInvalidData
+			}
+		})
+	if err == context.DeadlineExceeded {
+		err = ErrLostConn
+	}
+	if err != nil {
+		return
+	}
+	return e
+}
+
 // Echo.
 func (client *Client) Echo(data []byte) (echo []byte, err error) {
-	if client.conn == nil {
-		return nil, ErrLostConn
+	return client.EchoContext(context.Background(), data)
+}
+
+// EchoContext is Echo giving up when ctx is done.
+func (client *Client) EchoContext(ctx context.Context,
+	data []byte) (echo []byte, err error) {
+	var e []byte
+	err = client.roundTrip(ctx, "e", getRequest(protocol.EchoReq, data),
+		func(resp *Response) {
+			// resp.Data goes back to the pool after the handler
+			e = append([]byte(nil), resp.Data...)
+		})
+	if err != nil {
+		return
 	}
-	var mutex sync.Mutex
-	mutex.Lock()
-	client.innerHandler.put("e", func(resp *Response) {
-		echo = resp.Data
-		mutex.Unlock()
-	})
-	req := getRequest()
-	req.DataType = dtEchoReq
-	req.Data = data
-	client.write(req)
-	mutex.Lock()
-	return
+	return e, nil
 }
 
-// Close connection
+// Close connection. The client doesn't reconnect afterwards and
+// everything outstanding gets a *LostConnError.
 func (client *Client) Close() (err error) {
-	client.Lock()
-	defer client.Unlock()
+	client.wmutex.Lock()
+	select {
+	case <-client.closed:
+		client.wmutex.Unlock()
+		return
+	default:
+	}
+	close(client.closed)
 	if client.conn != nil {
 		err = client.conn.Close()
 		client.conn = nil
 	}
+	client.wmutex.Unlock()
+	client.event(StateClosed, 0, nil)
 	return
 }
 
@@ -326,16 +751,7 @@ func (client *Client) Close() (err error) {
 // flag can be set to: JobLow, JobNormal and JobHigh
 func (client *Client) DoWithId(funcname string, data []byte,
 	flag byte, h ResponseHandler, id string) (handle string, err error) {
-	var datatype uint32
-	switch flag {
-	case JobLow:
-		datatype = dtSubmitJobLow
-	case JobHigh:
-		datatype = dtSubmitJobHigh
-	default:
-		datatype = dtSubmitJob
-	}
-	handle, err = client.do(funcname, data, datatype, h, id)
+	handle, err = client.do(funcname, data, jobType(flag), h, id)
 	return
 }
 
@@ -343,18 +759,106 @@ func (client *Client) DoWithId(funcname string, data []byte,
 // flag can be set to: JobLow, JobNormal and JobHigh
 func (client *Client) DoBgWithId(funcname string, data []byte,
 	flag byte, id string) (handle string, err error) {
-	if client.conn == nil {
-		return "", ErrLostConn
+	handle, err = client.do(funcname, data, bgJobType(flag), nil, id)
+	return
+}
+
+func jobType(flag byte) protocol.PacketType {
+	switch flag {
+	case JobLow:
+		return protocol.SubmitJobLow
+	case JobHigh:
+		return protocol.SubmitJobHigh
 	}
-	var datatype uint32
+	return protocol.SubmitJob
+}
+
+func bgJobType(flag byte) protocol.PacketType {
 	switch flag {
 	case JobLow:
-		datatype = dtSubmitJobLowBg
+		return protocol.SubmitJobLowBg
 	case JobHigh:
-		datatype = dtSubmitJobHighBg
-	default:
-		datatype = dtSubmitJobBg
+		return protocol.SubmitJobHighBg
+	}
+	return protocol.SubmitJobBg
+}
+
+// Call the function in background at the time t.
+func (client *Client) DoEpoch(funcname string, data []byte,
+	t time.Time) (handle string, err error) {
+	handle, err = client.DoEpochWithId(funcname, data, t, client.id(funcname, data))
+	return
+}
+
+// Call the function in background at the time t.
+func (client *Client) DoEpochWithId(funcname string, data []byte,
+	t time.Time, id string) (handle string, err error) {
+	if len(id) == 0 {
+		return "", ErrInvalidId
+	}
+	req := getEpochJob(id, []byte(funcname), data, t.Unix())
+	handle, err = client.submitTimeout(req, nil)
+	return
+}
+
+// Call the function in background whenever sched matches.
+func (client *Client) DoSched(funcname string, data []byte,
+	sched *Schedule) (handle string, err error) {
+	handle, err = client.DoSchedWithId(funcname, data, sched, client.id(funcname, data))
+	return
+}
+
+// Call the function in background whenever sched matches.
+func (client *Client) DoSchedWithId(funcname string, data []byte,
+	sched *Schedule, id string) (handle string, err error) {
+	if len(id) == 0 {
+		return "", ErrInvalidId
+	}
+	if sched == nil {
+		return "", ErrInvalidData
+	}
+	req := getSchedJob(id, []byte(funcname), data, sched)
+	handle, err = client.submitTimeout(req, nil)
+	return
+}
+
+// Call the function as a map/reduce job and get a response.
+// The job server runs the function reducer over the results.
+func (client *Client) DoReduce(funcname, reducer string, data []byte,
+	h ResponseHandler) (handle string, err error) {
+	handle, err = client.DoReduceWithId(funcname, reducer, data, h, client.id(funcname, data))
+	return
+}
+
+// Call the function as a map/reduce job and get a response.
+func (client *Client) DoReduceWithId(funcname, reducer string, data []byte,
+	h ResponseHandler, id string) (handle string, err error) {
+	if len(id) == 0 {
+		return "", ErrInvalidId
+	}
+	req := getReduceJob(protocol.SubmitReduceJob, id, []byte(funcname),
+		[]byte(reducer), data)
+	handle, err = client.submitTimeout(req, h)
+	return
+}
+
+// Call the function as a map/reduce job in background,
+// no response needed.
+func (client *Client) DoReduceBg(funcname, reducer string,
+	data []byte) (handle string, err error) {
+	handle, err = client.DoReduceBgWithId(funcname, reducer, data, client.id(funcname, data))
+	return
+}
+
+// Call the function as a map/reduce job in background,
+// no response needed.
+func (client *Client) DoReduceBgWithId(funcname, reducer string,
+	data []byte, id string) (handle string, err error) {
+	if len(id) == 0 {
+		return "", ErrInvalidId
 	}
-	handle, err = client.do(funcname, data, datatype, nil, id)
+	req := getReduceJob(protocol.SubmitReduceJobBg, id, []byte(funcname),
+		[]byte(reducer), data)
+	handle, err = client.submitTimeout(req, nil)
 	return
 }
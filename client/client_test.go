@@ -1,14 +1,22 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
+	"crypto/tls"
 	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
 )
 
 const (
@@ -59,6 +67,19 @@ func TestClientEcho(t *testing.T) {
 	}
 }
 
+func TestClientSetServerOption(t *testing.T) {
+	if !runIntegrationTests {
+		t.Skip("To run this test, use: go test -integration")
+	}
+	if err := client.SetServerOption(OptionExceptions); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := client.SetServerOption("not exists"); err == nil {
+		t.Error("Expecting error")
+	}
+}
+
 func TestClientDoBg(t *testing.T) {
 	if !runIntegrationTests {
 		t.Skip("To run this test, use: go test -integration")
@@ -375,3 +396,536 @@ func TestClientClose(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestClientReadFragmented(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), 1<<18) // 4MB
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.EchoReq {
+			return
+		}
+		// a small piece, a status, and the echo back-to-back
+		status := protocol.NewResponse(protocol.StatusRes, []byte("H:1"),
+			[]byte("1"), []byte("0"), []byte("0"), []byte("0"))
+		writeFragmented(conn, 7, status,
+			protocol.NewResponse(protocol.EchoRes, req.Arg(0)))
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.ErrorHandler = func(e error) {
+		t.Error(e)
+	}
+	for _, data := range [][]byte{[]byte(TestStr), large} {
+		echo, err := c.Echo(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Compare(data, echo) != 0 {
+			t.Errorf("Echo error, %d bytes expected, %d got", len(data), len(echo))
+		}
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	// a job server which never answers
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	calls := map[string]func(ctx context.Context) error{
+		"DoContext": func(ctx context.Context) (err error) {
+			_, err = c.DoContext(ctx, "scheduledJobTest", []byte("abc"), JobNormal, nil)
+			return
+		},
+		"DoBgContext": func(ctx context.Context) (err error) {
+			_, err = c.DoBgContext(ctx, "scheduledJobTest", []byte("abc"), JobNormal)
+			return
+		},
+		"StatusContext": func(ctx context.Context) (err error) {
+			_, err = c.StatusContext(ctx, "H:1")
+			return
+		},
+		"EchoContext": func(ctx context.Context) (err error) {
+			_, err = c.EchoContext(ctx, []byte(TestStr))
+			return
+		},
+	}
+	for name, call := range calls {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err := call(ctx)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("%s: %v expected, %v got.", name, context.DeadlineExceeded, err)
+		}
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		if err = call(ctx); err != context.Canceled {
+			t.Errorf("%s: %v expected, %v got.", name, context.Canceled, err)
+		}
+		c.submits.Lock()
+		for _, s := range c.submits.pending {
+			if !s.abandoned {
+				t.Errorf("%s: requests should be abandoned.", name)
+			}
+		}
+		c.submits.Unlock()
+	}
+}
+
+func TestClientDoContext(t *testing.T) {
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.SubmitJob {
+			return
+		}
+		writeFragmented(conn, 5,
+			protocol.NewResponse(protocol.JobCreated, []byte("H:1")),
+			protocol.NewResponse(protocol.WorkComplete, []byte("H:1"), req.Arg(2)))
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	done := make(chan []byte, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	handle, err := c.DoContext(ctx, "echo", []byte(TestStr), JobNormal,
+		func(resp *Response) {
+			done <- append([]byte(nil), resp.Data...)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handle != "H:1" {
+		t.Errorf("%s expected, %s got.", "H:1", handle)
+	}
+	if data := <-done; string(data) != TestStr {
+		t.Errorf("%s expected, %s got.", TestStr, data)
+	}
+}
+
+func TestClientPipelined(t *testing.T) {
+	const n = 16
+	// The job server answers only when all the submissions are in,
+	// so they must be in flight together.
+	var ids [][]byte
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.SubmitJobBg {
+			return
+		}
+		ids = append(ids, append([]byte("H:"), req.Arg(1)...))
+		if len(ids) < n {
+			return
+		}
+		for _, h := range ids {
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h))
+		}
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			handle, err := c.DoBgContext(ctx, "pipelined", nil, JobNormal)
+			if err == nil && handle == "" {
+				err = fmt.Errorf("empty handle")
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestClientSubmitAbandoned(t *testing.T) {
+	// The first JOB_CREATED comes late, after its submitter gave up.
+	var created [][]byte
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.SubmitJob {
+			return
+		}
+		created = append(created, append([]byte("H:"), req.Arg(1)...))
+		if len(created) < 2 {
+			return
+		}
+		for _, h := range created {
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h))
+		}
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err = c.DoContext(ctx, "abandoned", nil, JobNormal, func(*Response) {
+		t.Error("Handler of an abandoned submission called")
+	})
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("%v expected, %v got.", context.DeadlineExceeded, err)
+	}
+	handle, err := c.DoWithId("second", nil, JobNormal, nil, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handle != "H:second" {
+		t.Errorf("%s expected, %s got.", "H:second", handle)
+	}
+}
+
+func TestClientSubmitError(t *testing.T) {
+	// The job server rejects the first submission, answering ERROR
+	// before the OPTION_RES of a later OPTION_REQ.
+	submitted := make(chan struct{}, 1)
+	rejected := false
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		switch req.Type {
+		case protocol.SubmitJobBg:
+			if rejected {
+				writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated,
+					append([]byte("H:"), req.Arg(1)...)))
+				return
+			}
+			submitted <- struct{}{}
+		case protocol.OptionReq:
+			rejected = true
+			writeFragmented(conn, 64,
+				protocol.NewResponse(protocol.Error, []byte("queue_full"),
+					[]byte("Job queue is full")),
+				protocol.NewResponse(protocol.OptionRes, req.Arg(0)))
+		}
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.DoBgWithId("full", nil, JobNormal, "1")
+		errs <- err
+	}()
+	<-submitted
+	if err = c.SetServerOption(OptionExceptions); err != nil {
+		t.Errorf("The option expected to be set, %v got.", err)
+	}
+	if err = <-errs; err == nil || !strings.Contains(err.Error(), "queue_full") {
+		t.Errorf("%s expected, %v got.", "queue_full", err)
+	}
+	for i := 2; i < 4; i++ {
+		id := strconv.Itoa(i)
+		handle, err := c.DoBgWithId("next", nil, JobNormal, id)
+		if err != nil || handle != "H:"+id {
+			t.Errorf("%s expected, %s, %v got.", "H:"+id, handle, err)
+		}
+	}
+}
+
+func TestClientStatusUniqueContext(t *testing.T) {
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.GetStatusUnique {
+			return
+		}
+		switch id := req.Arg(0); string(id) {
+		case "known":
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.StatusResUnique,
+				id, []byte("1"), []byte("1"), []byte("3"), []byte("4"), []byte("2")))
+		case "unsupported":
+			// an older job server
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.Error,
+				[]byte("ERR_UNKNOWN_COMMAND"), []byte("Unknown+server+command")))
+		}
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	status, err := c.StatusUniqueContext(ctx, "known")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.UniqueId != "known" || !status.Known || !status.Running ||
+		status.Numerator != 3 || status.Denominator != 4 || status.Waiting != 2 {
+		t.Errorf("The status expected, %+v got.", status)
+	}
+	if _, err = c.StatusUniqueContext(ctx, "unsupported"); err == nil ||
+		!strings.Contains(err.Error(), "ERR_UNKNOWN_COMMAND") {
+		t.Errorf("%s expected, %v got.", "ERR_UNKNOWN_COMMAND", err)
+	}
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err = c.StatusUniqueContext(short, "silent"); err != context.DeadlineExceeded {
+		t.Errorf("%v expected, %v got.", context.DeadlineExceeded, err)
+	}
+}
+
+func TestClientEchoConcurrent(t *testing.T) {
+	// The first ECHO_RES comes late, after its caller gave up, with
+	// the others.
+	const n = 8
+	var echoes [][]byte
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.EchoReq {
+			return
+		}
+		echoes = append(echoes, append([]byte(nil), req.Body()...))
+		if len(echoes) <= n {
+			return
+		}
+		for _, echo := range echoes {
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.EchoRes, echo))
+		}
+		echoes = nil
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err = c.EchoContext(ctx, []byte("abandoned"))
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("%v expected, %v got.", context.DeadlineExceeded, err)
+	}
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func(data string) {
+			echo, err := c.Echo([]byte(data))
+			if err == nil && string(echo) != data {
+				err = fmt.Errorf("%s expected, %s got.", data, echo)
+			}
+			errs <- err
+		}(strconv.Itoa(i))
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Echo expected to be answered.")
+		}
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		switch req.Type {
+		case protocol.SubmitJob:
+			writeFragmented(conn, 64,
+				protocol.NewResponse(protocol.JobCreated, []byte("H:1")))
+		case protocol.EchoReq:
+			writeFragmented(conn, 64,
+				protocol.NewResponse(protocol.EchoRes, req.Arg(0)))
+		}
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr(), WithBackoff(Backoff{
+		Initial:    10 * time.Millisecond,
+		Multiplier: 2,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	failed := make(chan error, 1)
+	if _, err = c.Do("lost", nil, JobNormal, func(resp *Response) {
+		_, err := resp.Result()
+		failed <- err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	srv.drop()
+	select {
+	case err = <-failed:
+		if !errors.Is(err, ErrLostConn) {
+			t.Errorf("%v expected, %v got.", ErrLostConn, err)
+		}
+		if _, ok := err.(*LostConnError); !ok {
+			t.Errorf("*LostConnError expected, %T got.", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The handler wasn't told the connection was lost.")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for {
+		echo, err := c.EchoContext(ctx, []byte(TestStr))
+		if err == nil {
+			if string(echo) != TestStr {
+				t.Errorf("%s expected, %s got.", TestStr, echo)
+			}
+			break
+		}
+		if !errors.Is(err, ErrLostConn) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientCloseStops(t *testing.T) {
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type == protocol.SubmitJob {
+			writeFragmented(conn, 64,
+				protocol.NewResponse(protocol.JobCreated, []byte("H:1")))
+		}
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr(), WithBackoff(Backoff{
+		Initial:    time.Millisecond,
+		Multiplier: 1,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	call, err := c.Call(context.Background(), "closed", nil, JobNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err = call.Wait(ctx); !errors.Is(err, ErrLostConn) {
+		t.Errorf("%v expected, %v got.", ErrLostConn, err)
+	}
+	if _, err = c.DoBg("closed", nil, JobNormal); err != ErrLostConn {
+		t.Errorf("%v expected, %v got.", ErrLostConn, err)
+	}
+	// both loops are done
+	if _, ok := <-c.in; ok {
+		t.Error("The read loop should be stopped.")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := srv.count(); n != 1 {
+		t.Errorf("No reconnection expected, %d connections got.", n)
+	}
+}
+
+func TestClientConnEvents(t *testing.T) {
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {})
+	defer srv.close()
+	events := make(chan ConnEvent, 16)
+	c, err := New(Network, srv.addr(), WithBackoff(Backoff{
+		Initial:    time.Millisecond,
+		Multiplier: 1,
+	}), WithConnHandler(func(e ConnEvent) {
+		events <- e
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := srv.addr()
+	expected := []ConnState{StateConnecting, StateConnected,
+		StateDisconnected, StateReconnecting, StateConnecting, StateConnected,
+		StateClosed}
+	for i, state := range expected {
+		switch state {
+		case StateDisconnected:
+			for srv.count() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			srv.drop()
+		case StateClosed:
+			c.Close()
+		}
+		e := <-events
+		if e.State != state || e.Addr != addr {
+			t.Errorf("%d: %s %s expected, %s %s got.", i, state, addr, e.State, e.Addr)
+		}
+		switch e.State {
+		case StateDisconnected:
+			if e.Err == nil {
+				t.Errorf("%d: the cause expected.", i)
+			}
+		case StateReconnecting:
+			if e.Attempt != 1 || e.Err == nil {
+				t.Errorf("%d: the 1st attempt and its cause expected, %d %v got.",
+					i, e.Attempt, e.Err)
+			}
+		}
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	serverConfig, clientConfig := testTLSConfigs(t)
+	srv := newTLSTestServer(t, serverConfig, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type == protocol.EchoReq {
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.EchoRes, req.Arg(0)))
+		}
+	})
+	defer srv.close()
+
+	// without the client certificate
+	c, err := New(Network, srv.addr(), WithTLS(&tls.Config{RootCAs: clientConfig.RootCAs}))
+	if err == nil {
+		if _, err = c.EchoContext(shortContext(t), []byte(TestStr)); err == nil {
+			t.Error("The server should refuse a client without certificate.")
+		}
+		c.Close()
+	}
+
+	c, err = New(Network, srv.addr(), WithTLS(clientConfig), WithBackoff(Backoff{
+		Initial:    time.Millisecond,
+		Multiplier: 1,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, ok := c.conn.(*tls.Conn); !ok {
+		t.Fatalf("*tls.Conn expected, %T got.", c.conn)
+	}
+	for i := 0; i < 2; i++ {
+		// echo after reconnecting over TLS again
+		ctx := shortContext(t)
+		for {
+			echo, err := c.EchoContext(ctx, []byte(TestStr))
+			if err == nil {
+				if string(echo) != TestStr {
+					t.Errorf("%s expected, %s got.", TestStr, echo)
+				}
+				break
+			}
+			if !errors.Is(err, ErrLostConn) {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		srv.drop()
+	}
+}
+
+func shortContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// JSON encodes values with encoding/json.
+	JSON Codec = jsonCodec{}
+	// Gob encodes values with encoding/gob.
+	Gob Codec = gobCodec{}
+	// Raw passes []byte and string through as they are.
+	Raw Codec = rawCodec{}
+
+	ErrCodecType = errors.New("Unsupported type")
+)
+
+// Codec turns values into job data and back.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// CodecError is the error of encoding the data of a job, or of
+// decoding its result. The job failed if it is nil.
+type CodecError struct {
+	Op       string // "marshal" or "unmarshal"
+	Funcname string
+	Err      error
+}
+
+func (e *CodecError) Error() string {
+	return fmt.Sprintf("Codec %s %s: %s", e.Op, e.Funcname, e.Err)
+}
+
+func (e *CodecError) Unwrap() error {
+	return e.Err
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrCodecType, v)
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *[]byte:
+		*v = data
+	case *string:
+		*v = string(data)
+	default:
+		return fmt.Errorf("%w: %T", ErrCodecType, v)
+	}
+	return nil
+}
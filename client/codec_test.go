@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+type codecTest struct {
+	Name  string
+	Count int
+}
+
+func TestCodecs(t *testing.T) {
+	v := codecTest{"foobar", 42}
+	for name, codec := range map[string]Codec{"json": JSON, "gob": Gob} {
+		data, err := codec.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got codecTest
+		if err = codec.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != v {
+			t.Errorf("%s: %v expected, %v got.", name, v, got)
+		}
+	}
+	data, err := Raw.Marshal("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b []byte
+	if err = Raw.Unmarshal(data, &b); err != nil || string(b) != "foobar" {
+		t.Errorf("%s expected, %s %v got.", "foobar", b, err)
+	}
+	if _, err = Raw.Marshal(v); !errors.Is(err, ErrCodecType) {
+		t.Errorf("%v expected, %v got.", ErrCodecType, err)
+	}
+	if err = Raw.Unmarshal(data, &v); !errors.Is(err, ErrCodecType) {
+		t.Errorf("%v expected, %v got.", ErrCodecType, err)
+	}
+}
+
+func TestFuncCall(t *testing.T) {
+	// "echo" echoes, "garbage" returns garbage and "fail" fails.
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.SubmitJob {
+			return
+		}
+		h := []byte("H:1")
+		result := protocol.NewResponse(protocol.WorkComplete, h, req.Arg(2))
+		switch string(req.Arg(0)) {
+		case "garbage":
+			result = protocol.NewResponse(protocol.WorkComplete, h, []byte("{"))
+		case "fail":
+			result = protocol.NewResponse(protocol.WorkFail, h)
+		}
+		writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h), result)
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	v := codecTest{"foobar", 42}
+	got, err := NewFunc[codecTest, codecTest]("echo", JSON).Call(ctx, c, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, got) {
+		t.Errorf("%v expected, %v got.", v, got)
+	}
+
+	var cerr *CodecError
+	_, err = NewFunc[codecTest, codecTest]("garbage", JSON).Call(ctx, c, v)
+	if !errors.As(err, &cerr) || cerr.Op != "unmarshal" {
+		t.Errorf("An unmarshal *CodecError expected, %v got.", err)
+	}
+	_, err = NewFunc[chan int, codecTest]("echo", JSON).Call(ctx, c, make(chan int))
+	if !errors.As(err, &cerr) || cerr.Op != "marshal" {
+		t.Errorf("A marshal *CodecError expected, %v got.", err)
+	}
+	_, err = NewFunc[codecTest, codecTest]("fail", JSON).Call(ctx, c, v)
+	if errors.As(err, &cerr) || !errors.Is(err, ErrWorkFail) {
+		t.Errorf("%v expected, %v got.", ErrWorkFail, err)
+	}
+
+	p := NewPool()
+	if err = p.Add(Network, srv.addr(), 1); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	s, err := NewFunc[string, string]("echo", Raw).Call(ctx, p, TestStr)
+	if err != nil || s != TestStr {
+		t.Errorf("%s expected, %s %v got.", TestStr, s, err)
+	}
+}
@@ -14,8 +14,29 @@ var (
 	ErrWorkException = errors.New("Work exeption")
 	ErrDataType      = errors.New("Invalid data type")
 	ErrLostConn      = errors.New("Lost connection with Gearmand")
+	ErrAbandoned     = errors.New("Job abandoned")
+	ErrStreamFull    = errors.New("Stream buffer full")
 )
 
+// LostConnError is given to everything outstanding on a connection
+// when it is lost. It matches ErrLostConn with errors.Is.
+type LostConnError struct {
+	Addr string
+	Err  error // the cause
+}
+
+func (e *LostConnError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", ErrLostConn, e.Addr, e.Err)
+}
+
+func (e *LostConnError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LostConnError) Is(target error) bool {
+	return target == ErrLostConn
+}
+
 // Extract the error message
 func getError(data []byte) (err error) {
 	rel := bytes.SplitN(data, []byte{'\x00'}, 2)
@@ -0,0 +1,39 @@
+package client
+
+import "github.com/mikespook/gearman-go/internal/transport"
+
+// ConnState is a state of the connection to a job server.
+type ConnState = transport.ConnState
+
+const (
+	StateConnecting   = transport.StateConnecting
+	StateConnected    = transport.StateConnected
+	StateDisconnected = transport.StateDisconnected
+	StateReconnecting = transport.StateReconnecting
+	StateClosed       = transport.StateClosed
+)
+
+// ConnEvent tells that the connection to the job server at Addr
+// changed its state.
+type ConnEvent = transport.ConnEvent
+
+// ConnHandler is called with every ConnEvent, in order, from the
+// connection's goroutines, so it must not block. The same handler can be
+// given to clients and workers.
+type ConnHandler = transport.ConnHandler
+
+// WithConnHandler makes the client tell h about its connection,
+// from the first connecting on. Given to NewPool, h hears about
+// every server in the pool.
+func WithConnHandler(h ConnHandler) Option {
+	return func(client *Client) {
+		client.connHandler = h
+	}
+}
+
+func (client *Client) event(state ConnState, attempt int, err error) {
+	if client.connHandler != nil {
+		client.connHandler(ConnEvent{Addr: client.addr, State: state,
+			Attempt: attempt, Err: err})
+	}
+}
@@ -1,7 +1,13 @@
 package client
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -22,6 +28,14 @@ type IdGenerator interface {
 	Id() string
 }
 
+// ContentIdGenerator makes the ID of a job from its function name
+// and data, when they are known. The job server coalesces the jobs
+// with the same ID, so jobs with the same content run once.
+type ContentIdGenerator interface {
+	IdGenerator
+	ContentId(funcname string, data []byte) string
+}
+
 // AutoIncId
 type autoincId struct {
 	value int64
@@ -40,3 +54,155 @@ func NewAutoIncId() IdGenerator {
 		value: int64(time.Now().Nanosecond()) << 32,
 	}
 }
+
+// UUIDv4
+type uuidv4Id struct{}
+
+func (uuidv4Id) Id() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	return formatUUID(b)
+}
+
+// NewUUIDv4Id returns a generator of random UUIDs, unique across
+// processes and hosts.
+func NewUUIDv4Id() IdGenerator {
+	return uuidv4Id{}
+}
+
+// UUIDv7
+type uuidv7Id struct {
+	sync.Mutex
+	now func() time.Time
+	ms  int64  // timestamp of the last ID
+	seq uint16 // 12 bits counter in the same millisecond
+}
+
+func (u *uuidv7Id) Id() string {
+	var b [16]byte
+	rand.Read(b[:])
+	u.Lock()
+	ms := u.now().UnixMilli()
+	if ms > u.ms {
+		u.ms = ms
+		// start low to leave room for counting up
+		u.seq = binary.BigEndian.Uint16(b[6:8]) & 0x7ff
+	} else if u.seq++; u.seq > 0xfff {
+		// borrow the next millisecond to stay ordered
+		u.ms++
+		u.seq = 0
+	}
+	ms, seq := u.ms, u.seq
+	u.Unlock()
+	putMillis(b[:6], ms)
+	binary.BigEndian.PutUint16(b[6:8], 0x7000|seq) // version 7
+	b[8] = b[8]&0x3f | 0x80                        // variant 10
+	return formatUUID(b)
+}
+
+// NewUUIDv7Id returns a generator of time-ordered UUIDs. The IDs of
+// a generator sort in the order they were made.
+func NewUUIDv7Id() IdGenerator {
+	return &uuidv7Id{now: time.Now}
+}
+
+// ULID
+type ulidId struct {
+	sync.Mutex
+	now     func() time.Time
+	ms      int64
+	entropy [10]byte
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func (u *ulidId) Id() string {
+	var b [16]byte
+	u.Lock()
+	ms := u.now().UnixMilli()
+	if ms > u.ms || !increment(u.entropy[:]) {
+		if ms <= u.ms {
+			// the entropy ran out, borrow the next millisecond
+			ms = u.ms + 1
+		}
+		u.ms = ms
+		rand.Read(u.entropy[:])
+	}
+	putMillis(b[:6], u.ms)
+	copy(b[6:], u.entropy[:])
+	u.Unlock()
+	// 26 characters of 5 bits, the first one has 2 leading zero bits
+	var s [26]byte
+	for i := range s {
+		var v byte
+		for j := 0; j < 5; j++ {
+			bit := i*5 + j - 2
+			v <<= 1
+			if bit >= 0 && b[bit/8]&(0x80>>uint(bit%8)) != 0 {
+				v |= 1
+			}
+		}
+		s[i] = crockford[v]
+	}
+	return string(s[:])
+}
+
+// NewULID returns a generator of ULIDs, time-ordered IDs in 26
+// characters of Crockford's base32.
+func NewULID() IdGenerator {
+	return &ulidId{now: time.Now}
+}
+
+// Content hash
+type hashId struct {
+	IdGenerator
+}
+
+func (h hashId) ContentId(funcname string, data []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(funcname))
+	sum.Write([]byte{0})
+	sum.Write(data)
+	return base64.RawURLEncoding.EncodeToString(sum.Sum(nil))
+}
+
+// NewHashId returns a generator of IDs hashing the function name and
+// the data with SHA-256, for submitting the same job twice to
+// deduplicate it on purpose. The foreground jobs of the same content
+// share the handle and the result of one job. Id, used when there is
+// no content, returns random UUIDs.
+func NewHashId() ContentIdGenerator {
+	return hashId{NewUUIDv4Id()}
+}
+
+// contentId makes the ID of a job with g.
+func contentId(g IdGenerator, funcname string, data []byte) string {
+	if cg, ok := g.(ContentIdGenerator); ok {
+		return cg.ContentId(funcname, data)
+	}
+	return g.Id()
+}
+
+func formatUUID(b [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// putMillis puts the 48 bits timestamp into b.
+func putMillis(b []byte, ms int64) {
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+// increment b as a big-endian number, it is false on overflow.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i]++; b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,13 @@
 package client
 
 import (
+	"context"
+	"net"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
 )
 
 func TestAutoInc(t *testing.T) {
@@ -16,3 +22,120 @@ func TestAutoInc(t *testing.T) {
 		previous = id
 	}
 }
+
+func TestUUIDv4(t *testing.T) {
+	g := NewUUIDv4Id()
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := g.Id()
+		if len(id) != 36 || id[14] != '4' || strings.IndexByte("89ab", id[19]) < 0 {
+			t.Fatalf("UUIDv4 expected, %s got.", id)
+		}
+		if seen[id] {
+			t.Fatalf("Id not unique: %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestTimeOrdered(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+	cases := map[string]IdGenerator{
+		"UUIDv7": &uuidv7Id{now: clock},
+		"ULID":   &ulidId{now: clock},
+	}
+	for name, g := range cases {
+		previous := g.Id()
+		// many IDs in the same millisecond, and a clock going back
+		for i := 0; i < 10000; i++ {
+			if i == 5000 {
+				now = now.Add(-time.Second)
+			}
+			id := g.Id()
+			if id <= previous {
+				t.Fatalf("%s: %s expected after %s.", name, id, previous)
+			}
+			previous = id
+		}
+		now = now.Add(time.Second)
+	}
+	if id := NewUUIDv7Id().Id(); len(id) != 36 || id[14] != '7' {
+		t.Errorf("UUIDv7 expected, %s got.", id)
+	}
+	if id := NewULID().Id(); len(id) != 26 || id[0] > '7' {
+		t.Errorf("ULID expected, %s got.", id)
+	}
+}
+
+func TestULIDEncoding(t *testing.T) {
+	g := &ulidId{now: func() time.Time { return time.UnixMilli(1469918176385) }}
+	// the timestamp part of the example in the ULID spec
+	if id := g.Id(); id[:10] != "01ARYZ6S41" {
+		t.Errorf("%s expected, %s got.", "01ARYZ6S41", id[:10])
+	}
+}
+
+func TestHashId(t *testing.T) {
+	g := NewHashId()
+	a := g.ContentId("fn", []byte("data"))
+	if a != g.ContentId("fn", []byte("data")) {
+		t.Error("The same content expected the same ID.")
+	}
+	if a == g.ContentId("fn", []byte("other")) || a == g.ContentId("fnd", []byte("ata")) {
+		t.Error("Different content expected different IDs.")
+	}
+	if len(a) > 64 {
+		t.Errorf("At most 64 bytes expected, %d got.", len(a))
+	}
+	client := &Client{idGen: g}
+	if id := client.id("fn", []byte("data")); id != a {
+		t.Errorf("%s expected, %s got.", a, id)
+	}
+	if g.Id() == g.Id() {
+		t.Error("Random IDs expected without content.")
+	}
+}
+
+func TestHashIdCoalesced(t *testing.T) {
+	// The job server runs the jobs of the same unique ID once.
+	running := make(map[string]int)
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.SubmitJob {
+			return
+		}
+		id := string(req.Arg(1))
+		h := []byte("H:" + id)
+		writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h))
+		if running[id]++; running[id] == 2 {
+			writeFragmented(conn, 64,
+				protocol.NewResponse(protocol.WorkComplete, h, req.Arg(2)))
+		}
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr(), WithIdGenerator(NewHashId()),
+		WithLimiter(NewLimiter(Limits{MaxInFlight: 2})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var calls []*Call
+	for i := 0; i < 2; i++ {
+		call, err := c.Call(ctx, "fn", []byte(TestStr), JobNormal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		calls = append(calls, call)
+	}
+	if calls[0].Handle != calls[1].Handle {
+		t.Errorf("The same handle expected, %s and %s got.", calls[0].Handle,
+			calls[1].Handle)
+	}
+	for i, call := range calls {
+		if data, err := call.Wait(ctx); err != nil || string(data) != TestStr {
+			t.Errorf("%d: %s expected, %s, %v got.", i, TestStr, data, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+// JobInfo describes a foreground job in flight, from JOB_CREATED
+// until it is done.
+type JobInfo struct {
+	Addr      string
+	Handle    string
+	Funcname  string
+	Id        string // the unique ID
+	Submitted time.Time
+	// The last WORK_STATUS
+	Numerator, Denominator uint64
+	// DataBytes counts the bytes of WORK_DATA received.
+	DataBytes int64
+}
+
+// job is the handler of a foreground job in flight.
+type job struct {
+	info  JobInfo // guarded by the jobMap
+	mutex sync.Mutex
+	h     ResponseHandler
+	done  bool
+}
+
+// handle passes resp to the handler, until the job is done. Handler
+// calls never overlap.
+func (j *job) handle(resp *Response) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.done {
+		return
+	}
+	switch resp.DataType {
+	case protocol.WorkComplete, protocol.WorkFail, protocol.WorkException:
+		j.done = true
+	}
+	if j.h != nil {
+		j.h(resp)
+	}
+}
+
+// fail the job locally with err.
+func (j *job) fail(err error) {
+	resp := getResponse()
+	resp.DataType = protocol.WorkFail
+	resp.Handle = j.info.Handle
+	resp.err = err
+	j.handle(resp)
+	resp.release()
+}
+
+// newJob returns the job of a foreground request.
+func (client *Client) newJob(req *protocol.Packet, h ResponseHandler) *job {
+	if !foreground(req.Type) {
+		return nil
+	}
+	return &job{h: h, info: JobInfo{
+		Addr:      client.addr,
+		Funcname:  string(req.Arg(0)),
+		Id:        string(req.Arg(1)),
+		Submitted: time.Now(),
+	}}
+}
+
+// jobPacket tells the packets of a job in flight.
+func jobPacket(tp protocol.PacketType) bool {
+	switch tp {
+	case protocol.WorkData, protocol.WorkWarning, protocol.WorkStatus,
+		protocol.WorkComplete, protocol.WorkFail, protocol.WorkException:
+		return true
+	}
+	return false
+}
+
+// jobMap holds the jobs in flight by handle. The job server gives
+// the submissions of the same unique ID the same handle, so there
+// can be several jobs of a handle.
+type jobMap struct {
+	sync.Mutex
+	holder map[string][]*job
+}
+
+func newJobMap() *jobMap {
+	return &jobMap{holder: make(map[string][]*job, queueSize)}
+}
+
+func (m *jobMap) put(j *job) {
+	m.Lock()
+	m.holder[j.info.Handle] = append(m.holder[j.info.Handle], j)
+	m.Unlock()
+}
+
+// get the jobs of resp, keeping their info up to date.
+func (m *jobMap) get(resp *Response) (jobs []*job) {
+	m.Lock()
+	defer m.Unlock()
+	jobs = m.holder[resp.Handle]
+	for _, j := range jobs {
+		switch resp.DataType {
+		case protocol.WorkData:
+			j.info.DataBytes += int64(len(resp.Data))
+		case protocol.WorkStatus:
+			if status, err := resp.Status(); err == nil {
+				j.info.Numerator, j.info.Denominator = status.Numerator, status.Denominator
+			}
+		}
+	}
+	return
+}
+
+func (m *jobMap) remove(handle string) (jobs []*job) {
+	m.Lock()
+	defer m.Unlock()
+	jobs = m.holder[handle]
+	delete(m.holder, handle)
+	return
+}
+
+// removeJob removes j alone, leaving the other jobs of its handle.
+// It is false if j is not in flight.
+func (m *jobMap) removeJob(j *job) bool {
+	m.Lock()
+	defer m.Unlock()
+	jobs := m.holder[j.info.Handle]
+	for i := range jobs {
+		if jobs[i] == j {
+			if len(jobs) == 1 {
+				delete(m.holder, j.info.Handle)
+			} else {
+				m.holder[j.info.Handle] = append(jobs[:i:i], jobs[i+1:]...)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (m *jobMap) removeAll() (jobs []*job) {
+	m.Lock()
+	defer m.Unlock()
+	for handle, js := range m.holder {
+		jobs = append(jobs, js...)
+		delete(m.holder, handle)
+	}
+	return
+}
+
+func (m *jobMap) list() (infos []JobInfo) {
+	m.Lock()
+	defer m.Unlock()
+	infos = make([]JobInfo, 0, len(m.holder))
+	for _, jobs := range m.holder {
+		for _, j := range jobs {
+			infos = append(infos, j.info)
+		}
+	}
+	return
+}
+
+// Jobs lists the foreground jobs in flight, the oldest first.
+func (client *Client) Jobs() []JobInfo {
+	infos := client.jobs.list()
+	sortJobs(infos)
+	return infos
+}
+
+// Abandon forgets the jobs of the handle in flight locally, their
+// handlers get a WORK_FAIL with ErrAbandoned as the Result error. The
+// job server and the worker are not told. It is false if there is no
+// such job.
+func (client *Client) Abandon(handle string) bool {
+	jobs := client.jobs.remove(handle)
+	for _, j := range jobs {
+		j.fail(ErrAbandoned)
+	}
+	return len(jobs) > 0
+}
+
+// Jobs lists the foreground jobs in flight on all the servers, the
+// oldest first.
+func (pool *Pool) Jobs() (infos []JobInfo) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	for _, item := range pool.Clients {
+		infos = append(infos, item.jobs.list()...)
+	}
+	sortJobs(infos)
+	return
+}
+
+// Abandon forgets the job in flight on the server addr locally.
+func (pool *Pool) Abandon(addr, handle string) bool {
+	item, ok := pool.client(addr)
+	return ok && item.Abandon(handle)
+}
+
+func sortJobs(infos []JobInfo) {
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].Submitted.Before(infos[j].Submitted)
+	})
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+func TestClientJobs(t *testing.T) {
+	// a job server whose jobs never complete
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		switch req.Type {
+		case protocol.SubmitJob, protocol.SubmitJobBg:
+			h := []byte("H:" + string(req.Arg(1)))
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h))
+			if req.Type == protocol.SubmitJob {
+				writeFragmented(conn, 64,
+					protocol.NewResponse(protocol.WorkStatus, h, []byte("1"), []byte("4")),
+					protocol.NewResponse(protocol.WorkData, h, []byte("abc")),
+					protocol.NewResponse(protocol.WorkData, h, []byte("de")))
+			}
+		}
+	})
+	defer srv.close()
+	p := NewPool()
+	if err := p.Add(Network, srv.addr(), 1); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	c := p.Clients[srv.addr()].Client
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	call, err := c.CallWithId(ctx, "fn", nil, JobNormal, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.DoBgWithId("fn", nil, JobNormal, "2"); err != nil {
+		t.Fatal(err)
+	}
+	var jobs []JobInfo
+	for {
+		if jobs = p.Jobs(); len(jobs) == 1 && jobs[0].DataBytes == 5 {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("A job with 5 bytes expected, %+v got.", jobs)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	info := jobs[0]
+	if info.Addr != srv.addr() || info.Handle != "H:1" || info.Funcname != "fn" ||
+		info.Id != "1" || info.Numerator != 1 || info.Denominator != 4 ||
+		info.Submitted.Before(start) {
+		t.Errorf("The job expected, %+v got.", info)
+	}
+	if p.Abandon("not exists", "H:1") {
+		t.Error("No job expected on an unknown server.")
+	}
+	if !p.Abandon(srv.addr(), "H:1") {
+		t.Error("The job expected to be abandoned.")
+	}
+	if _, err = call.Wait(ctx); !errors.Is(err, ErrAbandoned) {
+		t.Errorf("%v expected, %v got.", ErrAbandoned, err)
+	}
+	if jobs = c.Jobs(); len(jobs) != 0 {
+		t.Errorf("No job expected, %+v got.", jobs)
+	}
+	if c.Abandon("H:1") {
+		t.Error("The job expected to be abandoned once.")
+	}
+
+	// lost with the connection
+	if _, err = c.CallWithId(ctx, "fn", nil, JobNormal, "3"); err != nil {
+		t.Fatal(err)
+	}
+	srv.drop()
+	for len(c.Jobs()) != 0 {
+		if ctx.Err() != nil {
+			t.Fatal("The job expected to be lost.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClientJobsCoalesced(t *testing.T) {
+	// The job server coalesces the submissions of the same unique ID
+	// into a job of one handle, and completes it after the second.
+	submitted := 0
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.SubmitJob {
+			return
+		}
+		h := []byte("H:" + string(req.Arg(1)))
+		writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h))
+		if submitted++; submitted == 2 {
+			writeFragmented(conn, 64,
+				protocol.NewResponse(protocol.WorkData, h, []byte("abc")),
+				protocol.NewResponse(protocol.WorkComplete, h, []byte("done")),
+				protocol.NewResponse(protocol.WorkComplete, h, []byte("again")))
+		}
+	})
+	defer srv.close()
+	l := NewLimiter(Limits{MaxInFlight: 2})
+	c, err := New(Network, srv.addr(), WithLimiter(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var calls []*Call
+	for i := 0; i < 2; i++ {
+		call, err := c.CallWithId(ctx, "fn", nil, JobNormal, "same")
+		if err != nil {
+			t.Fatal(err)
+		}
+		calls = append(calls, call)
+	}
+	for i, call := range calls {
+		data, err := call.Wait(ctx)
+		if err != nil || string(data) != "done" {
+			t.Errorf("%d: %s expected, %s, %v got.", i, "done", data, err)
+		}
+		if chunks := call.Chunks(); len(chunks) != 1 || string(chunks[0]) != "abc" {
+			t.Errorf("%d: %q expected, %q got.", i, "abc", chunks)
+		}
+	}
+	if jobs := c.Jobs(); len(jobs) != 0 {
+		t.Errorf("No job expected, %+v got.", jobs)
+	}
+	if u := l.Usage(); u.InFlight != 0 {
+		t.Errorf("%d in flight expected, %d got.", 0, u.InFlight)
+	}
+}
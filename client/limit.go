@@ -0,0 +1,283 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+var (
+	ErrInFlightLimit = errors.New("Too many jobs in flight")
+	ErrRateLimit     = errors.New("Rate limit exceeded")
+)
+
+// LimitError is returned when a job is held back by a Limiter.
+type LimitError struct {
+	Funcname string
+	Err      error // ErrInFlightLimit or ErrRateLimit
+	Cause    error // the context error if it waited, nil if it failed fast
+}
+
+func (e *LimitError) Error() string {
+	if e.Cause == nil {
+		return fmt.Sprintf("%s: %s", e.Err, e.Funcname)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Err, e.Funcname, e.Cause)
+}
+
+func (e *LimitError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.Cause}
+}
+
+// Rate is a token bucket, it holds Burst jobs and refills PerSecond.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// burst is at least one job.
+func (rate Rate) burst() float64 {
+	if rate.Burst < 1 {
+		return 1
+	}
+	return float64(rate.Burst)
+}
+
+// Limits of a Limiter, the zero values are no limits.
+type Limits struct {
+	// MaxInFlight bounds the foreground jobs submitted and not done.
+	MaxInFlight int
+	// Rates are the rates of submitting jobs of the functions.
+	Rates map[string]Rate
+	// DefaultRate is the rate of the functions not in Rates.
+	DefaultRate Rate
+	// FailFast makes the jobs over a limit fail with a *LimitError,
+	// instead of waiting until the context is done.
+	FailFast bool
+}
+
+// Usage is what a Limiter has given out.
+type Usage struct {
+	InFlight    int                // foreground jobs not done
+	MaxInFlight int                // Limits.MaxInFlight
+	Waiting     int                // jobs waiting for a limit
+	Rejected    uint64             // jobs failed by a limit so far
+	Tokens      map[string]float64 // tokens in the bucket of every function
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter holds back the jobs submitted by the clients it is given
+// to with WithLimiter. Given to NewPool, the limits are for the whole
+// pool.
+type Limiter struct {
+	limits  Limits
+	slots   chan struct{} // one for every foreground job in flight
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	waiting int
+	rejects uint64
+	now     func() time.Time
+}
+
+// NewLimiter returns a limiter with limits.
+func NewLimiter(limits Limits) *Limiter {
+	l := &Limiter{
+		limits:  limits,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+	if limits.MaxInFlight > 0 {
+		l.slots = make(chan struct{}, limits.MaxInFlight)
+	}
+	return l
+}
+
+// Usage returns the current usage of the limiter.
+func (l *Limiter) Usage() Usage {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	u := Usage{
+		InFlight:    len(l.slots),
+		MaxInFlight: l.limits.MaxInFlight,
+		Waiting:     l.waiting,
+		Rejected:    l.rejects,
+		Tokens:      make(map[string]float64, len(l.buckets)),
+	}
+	now := l.now()
+	for funcname, b := range l.buckets {
+		l.refill(funcname, b, now)
+		u.Tokens[funcname] = b.tokens
+	}
+	return u
+}
+
+// acquire waits until a job of funcname is within the limits, or
+// fails fast. release must be called once the job is done. beforeWait,
+// if not nil, is called before waiting.
+func (l *Limiter) acquire(ctx context.Context, funcname string,
+	foreground bool, beforeWait func()) (release func(), err error) {
+	release = func() {}
+	if l.slots != nil && foreground {
+		if err = l.acquireSlot(ctx, funcname, beforeWait); err != nil {
+			return
+		}
+		var once sync.Once
+		release = func() {
+			once.Do(func() { <-l.slots })
+		}
+	}
+	if err = l.take(ctx, funcname, beforeWait); err != nil {
+		release()
+	}
+	return
+}
+
+func (l *Limiter) acquireSlot(ctx context.Context, funcname string,
+	beforeWait func()) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if l.limits.FailFast {
+		return l.reject(funcname, ErrInFlightLimit)
+	}
+	if beforeWait != nil {
+		beforeWait()
+	}
+	l.wait(1)
+	defer l.wait(-1)
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return &LimitError{Funcname: funcname, Err: ErrInFlightLimit,
+			Cause: ctx.Err()}
+	}
+}
+
+// take a token from the bucket of funcname, waiting for it to be
+// refilled if needed.
+func (l *Limiter) take(ctx context.Context, funcname string,
+	beforeWait func()) error {
+	rate, ok := l.limits.Rates[funcname]
+	if !ok {
+		rate = l.limits.DefaultRate
+	}
+	if rate.PerSecond <= 0 {
+		return nil
+	}
+	l.mutex.Lock()
+	b := l.buckets[funcname]
+	if b == nil {
+		b = &bucket{tokens: rate.burst(), last: l.now()}
+		l.buckets[funcname] = b
+	}
+	l.refill(funcname, b, l.now())
+	if b.tokens >= 1 {
+		b.tokens--
+		l.mutex.Unlock()
+		return nil
+	}
+	if l.limits.FailFast {
+		l.mutex.Unlock()
+		return l.reject(funcname, ErrRateLimit)
+	}
+	// The token is taken in advance, later jobs wait after this one.
+	b.tokens--
+	delay := time.Duration(-b.tokens / rate.PerSecond * float64(time.Second))
+	l.waiting++
+	l.mutex.Unlock()
+	defer l.wait(-1)
+	if beforeWait != nil {
+		beforeWait()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mutex.Lock()
+		b.tokens++
+		l.mutex.Unlock()
+		return &LimitError{Funcname: funcname, Err: ErrRateLimit,
+			Cause: ctx.Err()}
+	}
+}
+
+// refill the bucket up to the burst, the caller holds the mutex.
+func (l *Limiter) refill(funcname string, b *bucket, now time.Time) {
+	rate, ok := l.limits.Rates[funcname]
+	if !ok {
+		rate = l.limits.DefaultRate
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * rate.PerSecond
+		b.last = now
+	}
+	if burst := rate.burst(); b.tokens > burst {
+		b.tokens = burst
+	}
+}
+
+func (l *Limiter) wait(n int) {
+	l.mutex.Lock()
+	l.waiting += n
+	l.mutex.Unlock()
+}
+
+func (l *Limiter) reject(funcname string, err error) error {
+	l.mutex.Lock()
+	l.rejects++
+	l.mutex.Unlock()
+	return &LimitError{Funcname: funcname, Err: err}
+}
+
+// limit acquires the limits of a job for the client, wrapping h to
+// release them once a foreground job is done.
+func (client *Client) limit(ctx context.Context, funcname string, foreground bool,
+	h ResponseHandler, beforeWait func()) (release func(), wrapped ResponseHandler, err error) {
+	if client.limiter == nil {
+		return func() {}, h, nil
+	}
+	release, err = client.limiter.acquire(ctx, funcname, foreground, beforeWait)
+	if err != nil {
+		return
+	}
+	if !foreground {
+		return release, h, nil
+	}
+	wrapped = func(resp *Response) {
+		if h != nil {
+			h(resp)
+		}
+		switch resp.DataType {
+		case protocol.WorkComplete, protocol.WorkFail, protocol.WorkException:
+			release()
+		}
+	}
+	return
+}
+
+// foreground tells if the job of the request has a result to wait
+// for.
+func foreground(tp protocol.PacketType) bool {
+	switch tp {
+	case protocol.SubmitJob, protocol.SubmitJobLow, protocol.SubmitJobHigh,
+		protocol.SubmitReduceJob:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+func TestLimiterInFlight(t *testing.T) {
+	l := NewLimiter(Limits{MaxInFlight: 1, FailFast: true})
+	ctx := context.Background()
+	release, err := l.acquire(ctx, "fn", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.acquire(ctx, "fn", false, nil); err != nil {
+		t.Errorf("Background jobs expected not counted, %v got.", err)
+	}
+	if _, err = l.acquire(ctx, "fn", true, nil); !errors.Is(err, ErrInFlightLimit) {
+		t.Errorf("%v expected, %v got.", ErrInFlightLimit, err)
+	}
+	if u := l.Usage(); u.InFlight != 1 || u.Rejected != 1 {
+		t.Errorf("1 in flight and 1 rejected expected, %+v got.", u)
+	}
+	release()
+	release()
+	if _, err = l.acquire(ctx, "fn", true, nil); err != nil {
+		t.Error(err)
+	}
+
+	// waiting until ctx is done
+	l = NewLimiter(Limits{MaxInFlight: 1})
+	l.acquire(ctx, "fn", true, nil)
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	waited := false
+	_, err = l.acquire(ctx, "fn", true, func() { waited = true })
+	if !errors.Is(err, ErrInFlightLimit) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("%v expected, %v got.", ErrInFlightLimit, err)
+	}
+	if !waited {
+		t.Error("beforeWait expected to be called.")
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewLimiter(Limits{
+		Rates:       map[string]Rate{"fn": {PerSecond: 10, Burst: 2}},
+		DefaultRate: Rate{PerSecond: 1},
+		FailFast:    true,
+	})
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := l.acquire(ctx, "fn", false, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var lerr *LimitError
+	if _, err := l.acquire(ctx, "fn", false, nil); !errors.As(err, &lerr) ||
+		lerr.Err != ErrRateLimit || lerr.Funcname != "fn" {
+		t.Errorf("%v expected, %v got.", ErrRateLimit, err)
+	}
+	if _, err := l.acquire(ctx, "other", false, nil); err != nil {
+		t.Error(err)
+	}
+	if _, err := l.acquire(ctx, "other", false, nil); !errors.Is(err, ErrRateLimit) {
+		t.Errorf("%v expected, %v got.", ErrRateLimit, err)
+	}
+	now = now.Add(150 * time.Millisecond)
+	if u := l.Usage(); u.Tokens["fn"] != 1.5 || u.Tokens["other"] != 0.15 {
+		t.Errorf("1.5 and 0.15 tokens expected, %v got.", u.Tokens)
+	}
+	if _, err := l.acquire(ctx, "fn", false, nil); err != nil {
+		t.Error(err)
+	}
+
+	// waiting for the bucket to be refilled
+	l = NewLimiter(Limits{DefaultRate: Rate{PerSecond: 50, Burst: 1}})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := l.acquire(ctx, "fn", false, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 35*time.Millisecond {
+		t.Errorf("40ms expected, %v got.", d)
+	}
+}
+
+func TestClientLimiter(t *testing.T) {
+	conns := make(chan net.Conn, 16)
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		switch req.Type {
+		case protocol.SubmitJob, protocol.SubmitJobBg:
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated,
+				[]byte("H:"+string(req.Arg(1)))))
+			conns <- conn
+		}
+	})
+	defer srv.close()
+	l := NewLimiter(Limits{MaxInFlight: 1, FailFast: true})
+	c, err := New(Network, srv.addr(), WithLimiter(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	call, err := c.CallWithId(ctx, "fn", nil, JobNormal, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := <-conns
+	if _, err = c.DoBg("fn", nil, JobNormal); err != nil {
+		t.Errorf("Background jobs expected not limited, %v got.", err)
+	}
+	<-conns
+	if _, err = c.Call(ctx, "fn", nil, JobNormal); !errors.Is(err, ErrInFlightLimit) {
+		t.Errorf("%v expected, %v got.", ErrInFlightLimit, err)
+	}
+	results := c.DoBatch(ctx, []JobSpec{{Funcname: "fn", Id: "2"}})
+	if !errors.Is(results[0].Err, ErrInFlightLimit) {
+		t.Errorf("%v expected, %v got.", ErrInFlightLimit, results[0].Err)
+	}
+	writeFragmented(conn, 64, protocol.NewResponse(protocol.WorkComplete,
+		[]byte(call.Handle), nil))
+	if _, err = call.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if u := l.Usage(); u.InFlight != 0 {
+		t.Errorf("%d in flight expected, %d got.", 0, u.InFlight)
+	}
+	results = c.DoBatch(ctx, []JobSpec{{Funcname: "fn", Id: "3"}})
+	if results[0].Err != nil || results[0].Handle != "H:3" {
+		t.Errorf("%s expected, %+v got.", "H:3", results[0])
+	}
+	// lost with the connection
+	<-conns
+	srv.drop()
+	for l.Usage().InFlight != 0 {
+		if ctx.Err() != nil {
+			t.Fatal("The job expected to be released.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClientLimiterBatch(t *testing.T) {
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type == protocol.SubmitJob {
+			h := []byte("H:" + string(req.Arg(1)))
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h),
+				protocol.NewResponse(protocol.WorkComplete, h, nil))
+		}
+	})
+	defer srv.close()
+	// the second job waits for the first one, which is flushed first
+	c, err := New(Network, srv.addr(), WithLimiter(NewLimiter(Limits{MaxInFlight: 1})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	results := c.DoBatch(ctx, []JobSpec{{Funcname: "fn", Id: "1"},
+		{Funcname: "fn", Id: "2"}})
+	for i, r := range results {
+		if r.Err != nil {
+			t.Errorf("%d: %v", i, r.Err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrAborted is the error of the inputs a fail-fast Map gave up.
+	ErrAborted = errors.New("Aborted by a failed job")
+)
+
+// MapResult is the result of the job of inputs[Index].
+type MapResult struct {
+	Index int
+	Data  []byte
+	Err   error
+}
+
+// MapError tells which jobs of a Map failed.
+type MapError struct {
+	Failed []int // indexes of the failed inputs, in order
+	Err    error // error of the first one
+}
+
+func (e *MapError) Error() string {
+	return fmt.Sprintf("%d jobs failed, input %d: %s", len(e.Failed),
+		e.Failed[0], e.Err)
+}
+
+func (e *MapError) Unwrap() error {
+	return e.Err
+}
+
+// MapOption configures Map and MapStream.
+type MapOption func(*mapConfig)
+
+type mapConfig struct {
+	inFlight int
+	failFast bool
+	flag     byte
+}
+
+// MapInFlight bounds the jobs running at the same time, 8 by default.
+func MapInFlight(n int) MapOption {
+	return func(cfg *mapConfig) {
+		cfg.inFlight = n
+	}
+}
+
+// MapFailFast stops submitting and waiting after the first failed
+// job, the rest of the inputs get ErrAborted. Without it, all the
+// jobs run and every error is collected.
+func MapFailFast() MapOption {
+	return func(cfg *mapConfig) {
+		cfg.failFast = true
+	}
+}
+
+// MapPriority submits the jobs with flag: JobLow, JobNormal and JobHigh
+func MapPriority(flag byte) MapOption {
+	return func(cfg *mapConfig) {
+		cfg.flag = flag
+	}
+}
+
+// Map calls the function with every input and returns the results
+// in the order of inputs. err is a *MapError if any job failed.
+func (client *Client) Map(ctx context.Context, funcname string,
+	inputs [][]byte, opts ...MapOption) (results []MapResult, err error) {
+	return collect(len(inputs), client.MapStream(ctx, funcname, inputs, opts...))
+}
+
+// MapStream calls the function with every input and sends the
+// results as the jobs finish. There is one result for every input,
+// the channel is closed after the last one.
+func (client *Client) MapStream(ctx context.Context, funcname string,
+	inputs [][]byte, opts ...MapOption) <-chan MapResult {
+	return mapStream(ctx, client, funcname, inputs, opts)
+}
+
+// Map calls the function with every input, every job on a server
+// selected by SelectionHandler.
+func (pool *Pool) Map(ctx context.Context, funcname string,
+	inputs [][]byte, opts ...MapOption) (results []MapResult, err error) {
+	return collect(len(inputs), pool.MapStream(ctx, funcname, inputs, opts...))
+}
+
+// MapStream is Map sending the results as the jobs finish.
+func (pool *Pool) MapStream(ctx context.Context, funcname string,
+	inputs [][]byte, opts ...MapOption) <-chan MapResult {
+	return mapStream(ctx, pool, funcname, inputs, opts)
+}
+
+func mapStream(parent context.Context, s Submitter, funcname string,
+	inputs [][]byte, opts []MapOption) <-chan MapResult {
+	cfg := mapConfig{inFlight: queueSize, flag: JobNormal}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.inFlight <= 0 {
+		cfg.inFlight = 1
+	}
+	out := make(chan MapResult, len(inputs))
+	go func() {
+		ctx, cancel := context.WithCancel(parent)
+		defer cancel()
+		// Errors of the internal cancel are the fail-fast ones.
+		cause := func(err error) error {
+			if err == context.Canceled && parent.Err() == nil {
+				return ErrAborted
+			}
+			return err
+		}
+		done := func(r MapResult) {
+			if r.Err != nil && cfg.failFast {
+				cancel()
+			}
+			out <- r
+		}
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, cfg.inFlight)
+		for i, data := range inputs {
+			acquired := false
+			select {
+			case sem <- struct{}{}:
+				acquired = true
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				if acquired {
+					<-sem
+				}
+				done(MapResult{Index: i, Err: cause(ctx.Err())})
+				continue
+			}
+			wg.Add(1)
+			go func(i int, data []byte) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				r := MapResult{Index: i}
+				c, err := s.call(ctx, funcname, data, cfg.flag)
+				if err == nil {
+					r.Data, err = c.Wait(ctx)
+				}
+				r.Err = cause(err)
+				done(r)
+			}(i, data)
+		}
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// collect puts the n results in order.
+func collect(n int, stream <-chan MapResult) (results []MapResult, err error) {
+	results = make([]MapResult, n)
+	var failed []int
+	for r := range stream {
+		results[r.Index] = r
+		if r.Err != nil && r.Err != ErrAborted {
+			failed = append(failed, r.Index)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Ints(failed)
+		err = &MapError{Failed: failed, Err: results[failed[0]].Err}
+	}
+	return
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+// A job server running every job for a while, "fail" fails.
+type mapServer struct {
+	*testServer
+	mutex               sync.Mutex
+	inFlight, maxFlight int
+}
+
+func newMapServer(t *testing.T) *mapServer {
+	srv := &mapServer{}
+	srv.testServer = newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.SubmitJob {
+			return
+		}
+		h := append([]byte("H:"), req.Arg(1)...)
+		data := append([]byte(nil), req.Arg(2)...)
+		srv.mutex.Lock()
+		writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h))
+		if srv.inFlight++; srv.inFlight > srv.maxFlight {
+			srv.maxFlight = srv.inFlight
+		}
+		srv.mutex.Unlock()
+		go func() {
+			time.Sleep(5 * time.Millisecond)
+			srv.mutex.Lock()
+			defer srv.mutex.Unlock()
+			srv.inFlight--
+			if string(data) == "fail" {
+				writeFragmented(conn, 64, protocol.NewResponse(protocol.WorkFail, h))
+				return
+			}
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.WorkComplete, h, data))
+		}()
+	})
+	return srv
+}
+
+func mapInputs(n int, fails ...int) (inputs [][]byte) {
+	inputs = make([][]byte, n)
+	for i := range inputs {
+		inputs[i] = []byte(fmt.Sprint(i))
+	}
+	for _, i := range fails {
+		inputs[i] = []byte("fail")
+	}
+	return
+}
+
+func TestClientMap(t *testing.T) {
+	srv := newMapServer(t)
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	inputs := mapInputs(20, 2, 5)
+	results, err := c.Map(ctx, "map", inputs, MapInFlight(3))
+	var merr *MapError
+	if !errors.As(err, &merr) || fmt.Sprint(merr.Failed) != "[2 5]" {
+		t.Errorf("Inputs [2 5] should fail, %v got.", err)
+	}
+	if !errors.Is(err, ErrWorkFail) {
+		t.Errorf("%v expected, %v got.", ErrWorkFail, err)
+	}
+	for i, r := range results {
+		if r.Index != i {
+			t.Errorf("%d expected, %d got.", i, r.Index)
+		}
+		if r.Err == nil && string(r.Data) != string(inputs[i]) {
+			t.Errorf("%s expected, %s got.", inputs[i], r.Data)
+		}
+	}
+	if srv.maxFlight > 3 {
+		t.Errorf("At most %d jobs in flight expected, %d got.", 3, srv.maxFlight)
+	}
+
+	results, err = c.Map(ctx, "map", mapInputs(10, 1), MapInFlight(1), MapFailFast())
+	if !errors.As(err, &merr) || fmt.Sprint(merr.Failed) != "[1]" {
+		t.Errorf("Input [1] should fail, %v got.", err)
+	}
+	if results[0].Err != nil {
+		t.Error(results[0].Err)
+	}
+	for _, r := range results[2:] {
+		if r.Err != ErrAborted {
+			t.Errorf("%d: %v expected, %v got.", r.Index, ErrAborted, r.Err)
+		}
+	}
+
+	n := 0
+	for r := range c.MapStream(ctx, "map", mapInputs(10)) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+		n++
+	}
+	if n != 10 {
+		t.Errorf("%d results expected, %d got.", 10, n)
+	}
+}
+
+func TestPoolMap(t *testing.T) {
+	srvs := []*mapServer{newMapServer(t), newMapServer(t)}
+	pool := NewPool()
+	for _, srv := range srvs {
+		defer srv.close()
+		if err := pool.Add(Network, srv.addr(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer pool.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	inputs := mapInputs(20, 7)
+	results, err := pool.Map(ctx, "map", inputs, MapInFlight(8))
+	var merr *MapError
+	if !errors.As(err, &merr) || fmt.Sprint(merr.Failed) != "[7]" {
+		t.Errorf("Input [7] should fail, %v got.", err)
+	}
+	for i, r := range results {
+		if r.Err == nil && string(r.Data) != string(inputs[i]) {
+			t.Errorf("%s expected, %s got.", inputs[i], r.Data)
+		}
+	}
+
+	n := 0
+	for r := range pool.MapStream(ctx, "map", mapInputs(20), MapInFlight(8)) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+		n++
+	}
+	if n != 20 {
+		t.Errorf("%d results expected, %d got.", 20, n)
+	}
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/mikespook/gearman-go/internal/transport"
+)
+
+// Server options, see (*Client).SetServerOption.
+const (
+	// Forward WORK_EXCEPTION packets to this client.
+	OptionExceptions = "exceptions"
+)
+
+// Option configures a client in New and NewPool.
+type Option func(*Client)
+
+// WithServerOption requests the server option name (eg.
+// OptionExceptions) right after connecting. New fails if the job
+// server refuses the option.
+func WithServerOption(name string) Option {
+	return func(client *Client) {
+		client.serverOptions = append(client.serverOptions, name)
+	}
+}
+
+// WithBackoff sets how the client reconnects after losing the
+// connection, see DefaultBackoff.
+func WithBackoff(b Backoff) Option {
+	return func(client *Client) {
+		client.backoff = b
+	}
+}
+
+// WithTLS makes the client connect over TLS with config, also when
+// reconnecting. Set config.Certificates for mutual TLS.
+func WithTLS(config *tls.Config) Option {
+	return func(client *Client) {
+		client.tlsConfig = config
+	}
+}
+
+// DialFunc connects to the job server at addr, eg.
+// (*net.Dialer).DialContext.
+type DialFunc = transport.DialFunc
+
+// WithDialer makes the client connect with dial, eg. through a proxy.
+// TLS, if any, is handshaked over the connection dial returns.
+func WithDialer(dial DialFunc) Option {
+	return func(client *Client) {
+		client.dialer = dial
+	}
+}
+
+// WithConnectTimeout bounds dialing and the TLS handshake.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(client *Client) {
+		client.connectTimeout = d
+	}
+}
+
+// WithReadTimeout takes the connection as lost when an answer is
+// overdue for d. A connection idle for d, eg. while jobs run, is
+// checked with an ECHO_REQ.
+func WithReadTimeout(d time.Duration) Option {
+	return func(client *Client) {
+		client.readTimeout = d
+	}
+}
+
+// WithWriteTimeout takes the connection as lost when a write is stuck
+// for d.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(client *Client) {
+		client.writeTimeout = d
+	}
+}
+
+// WithBufferSizes sets the sizes of the read and write buffers of
+// the connection.
+func WithBufferSizes(read, write int) Option {
+	return func(client *Client) {
+		client.readBufferSize = read
+		client.writeBufferSize = write
+	}
+}
+
+// WithStreamBuffer bounds the output a Stream holds unread to n
+// bytes, DefaultStreamBuffer by default.
+func WithStreamBuffer(n int) Option {
+	return func(client *Client) {
+		client.streamBuffer = n
+	}
+}
+
+// WithStreamBackpressure makes a full Stream hold up the connection
+// until it is read, instead of failing with ErrStreamFull. Everything
+// else on the connection waits meanwhile: the other jobs, the answers
+// and the read timeout. Read or Close every stream.
+func WithStreamBackpressure() Option {
+	return func(client *Client) {
+		client.streamBackpressure = true
+	}
+}
+
+// WithMaxPacketSize bounds the packets read from the job server to n
+// bytes, protocol.DefaultMaxSize by default. The jobs of a larger
+// packet, eg. a big WORK_COMPLETE, fail with a *protocol.SizeError;
+// the connection and the other jobs go on. Stream a big output
+// instead.
+func WithMaxPacketSize(n int) Option {
+	return func(client *Client) {
+		client.maxPacketSize = n
+	}
+}
+
+// WithResponseTimeout sets ResponseTimeout.
+func WithResponseTimeout(d time.Duration) Option {
+	return func(client *Client) {
+		client.ResponseTimeout = d
+	}
+}
+
+// WithErrorHandler sets ErrorHandler before connecting.
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(client *Client) {
+		client.ErrorHandler = h
+	}
+}
+
+// WithIdGenerator makes the client take unique IDs from g instead
+// of IdGen. Given to NewPool, g is shared by the clients of the pool.
+// A ContentIdGenerator makes the IDs from the jobs.
+func WithIdGenerator(g IdGenerator) Option {
+	return func(client *Client) {
+		client.idGen = g
+	}
+}
+
+// WithLimiter holds the jobs of the client back by the limits of l.
+// Given to NewPool, l limits the whole pool.
+func WithLimiter(l *Limiter) Option {
+	return func(client *Client) {
+		client.limiter = l
+	}
+}
+
+// WithClientId sends SET_CLIENT_ID with id on every (re)connection,
+// it shows up in the admin "workers" listing.
+func WithClientId(id string) Option {
+	return func(client *Client) {
+		client.clientId = id
+	}
+}
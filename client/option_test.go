@@ -0,0 +1,301 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+type fixedId string
+
+func (id fixedId) Id() string {
+	return string(id)
+}
+
+func TestClientOptions(t *testing.T) {
+	got := make(chan *protocol.Packet, 16)
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		got <- protocol.NewRequest(req.Type, append([]byte(nil), req.Body()...))
+		if req.Type == protocol.SubmitJobBg {
+			writeFragmented(conn, 64,
+				protocol.NewResponse(protocol.JobCreated, []byte("H:1")))
+		}
+	})
+	defer srv.close()
+	dialed := 0
+	c, err := New(Network, srv.addr(),
+		WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed++
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}),
+		WithConnectTimeout(time.Second),
+		WithBufferSizes(64, 64),
+		WithClientId("client-1"),
+		WithIdGenerator(fixedId("unique-1")),
+		WithBackoff(Backoff{Initial: time.Millisecond, Multiplier: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	expect := func(tp protocol.PacketType, body string) {
+		select {
+		case p := <-got:
+			if p.Type != tp || string(p.Body()) != body {
+				t.Errorf("%s %q expected, %s %q got.", tp, body, p.Type, p.Body())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s expected.", tp)
+		}
+	}
+	expect(protocol.SetClientId, "client-1")
+	if _, err = c.DoBg("fn", []byte("data"), JobNormal); err != nil {
+		t.Fatal(err)
+	}
+	expect(protocol.SubmitJobBg, "fn\x00unique-1\x00data")
+	for srv.count() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	srv.drop()
+	// sent again after reconnecting
+	expect(protocol.SetClientId, "client-1")
+	if dialed != 2 {
+		t.Errorf("%d dials expected, %d got.", 2, dialed)
+	}
+}
+
+func TestClientReadTimeout(t *testing.T) {
+	// a job server which never answers
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {})
+	defer srv.close()
+	lost := make(chan error, 1)
+	c, err := New(Network, srv.addr(), WithReadTimeout(20*time.Millisecond),
+		WithConnHandler(func(e ConnEvent) {
+			if e.State == StateDisconnected {
+				select {
+				case lost <- e.Err:
+				default:
+				}
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	select {
+	case err = <-lost:
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Errorf("A timeout expected, %v got.", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("The connection should be lost after the read timeout.")
+	}
+}
+
+func TestClientReadTimeoutIdle(t *testing.T) {
+	// a job server which answers ECHO_REQ, but whose job takes longer
+	// than the read timeout
+	echoes := make(chan struct{}, 16)
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		switch req.Type {
+		case protocol.EchoReq:
+			echoes <- struct{}{}
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.EchoRes, req.Body()))
+		case protocol.SubmitJob:
+			h := []byte("H:1")
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h))
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				writeFragmented(conn, 64, protocol.NewResponse(protocol.WorkComplete, h, req.Arg(2)))
+			}()
+		}
+	})
+	defer srv.close()
+	lost := make(chan error, 1)
+	c, err := New(Network, srv.addr(), WithReadTimeout(20*time.Millisecond),
+		WithConnHandler(func(e ConnEvent) {
+			if e.State == StateDisconnected {
+				lost <- e.Err
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	call, err := c.Call(ctx, "slow", []byte(TestStr), JobNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := call.Wait(ctx); err != nil || string(data) != TestStr {
+		t.Errorf("%s expected, %s, %v got.", TestStr, data, err)
+	}
+	select {
+	case err = <-lost:
+		t.Errorf("No disconnection expected, %v got.", err)
+	default:
+	}
+	if len(echoes) == 0 {
+		t.Error("ECHO_REQ expected to keep the connection alive.")
+	}
+}
+
+func TestClientServerOptions(t *testing.T) {
+	// a job server which only knows the exceptions option
+	requested := make(chan string, 16)
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.OptionReq {
+			return
+		}
+		name := append([]byte(nil), req.Arg(0)...)
+		requested <- string(name)
+		if string(name) == OptionExceptions {
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.OptionRes, name))
+		} else {
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.Error,
+				[]byte("ERR_UNKNOWN_OPTION"), []byte("Unknown+server+option")))
+		}
+	})
+	defer srv.close()
+	expect := func(name string) {
+		select {
+		case got := <-requested:
+			if got != name {
+				t.Errorf("%s expected, %s got.", name, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s expected.", name)
+		}
+	}
+
+	if _, err := New(Network, srv.addr(), WithServerOption("not exists")); err == nil {
+		t.Error("Unknown options expected to fail New.")
+	}
+	expect("not exists")
+
+	c, err := New(Network, srv.addr(), WithServerOption(OptionExceptions),
+		WithBackoff(Backoff{Initial: time.Millisecond, Multiplier: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	expect(OptionExceptions)
+	if err = c.SetServerOption("not exists"); err == nil {
+		t.Error("Unknown options expected to fail.")
+	}
+	expect("not exists")
+	if err = c.SetServerOption(OptionExceptions); err != nil {
+		t.Error(err)
+	}
+	expect(OptionExceptions)
+
+	// requested again after reconnecting, only once
+	for srv.count() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	srv.drop()
+	expect(OptionExceptions)
+	select {
+	case name := <-requested:
+		t.Errorf("No more options expected, %s got.", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestClientServerOptionsReconnect(t *testing.T) {
+	// The job server refuses the option after the reconnection, the
+	// ERROR comes along with the answer of the next submission.
+	var mutex sync.Mutex
+	options := 0
+	reconnected := make(chan struct{})
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch req.Type {
+		case protocol.OptionReq:
+			if options++; options == 1 {
+				writeFragmented(conn, 64, protocol.NewResponse(protocol.OptionRes, req.Arg(0)))
+			} else {
+				close(reconnected)
+			}
+		case protocol.SubmitJobBg:
+			writeFragmented(conn, 64,
+				protocol.NewResponse(protocol.Error,
+					[]byte("ERR_UNKNOWN_OPTION"), []byte("Unknown+server+option")),
+				protocol.NewResponse(protocol.JobCreated, []byte("H:1")))
+		}
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr(), WithServerOption(OptionExceptions),
+		WithBackoff(Backoff{Initial: time.Millisecond, Multiplier: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	srv.drop()
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("The option expected again after reconnecting.")
+	}
+	if handle, err := c.DoBg("fn", nil, JobNormal); err != nil || handle != "H:1" {
+		t.Errorf("%s expected, %s, %v got.", "H:1", handle, err)
+	}
+}
+
+func TestClientMaxPacketSize(t *testing.T) {
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		switch req.Type {
+		case protocol.SubmitJob:
+			h := []byte("H:" + string(req.Arg(0)))
+			data := []byte("done")
+			if string(req.Arg(0)) == "big" {
+				data = make([]byte, 2048)
+			}
+			writeFragmented(conn, 64,
+				protocol.NewResponse(protocol.JobCreated, h),
+				protocol.NewResponse(protocol.WorkComplete, h, data))
+		case protocol.EchoReq:
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.EchoRes, req.Arg(0)))
+		}
+	})
+	defer srv.close()
+	errs := make(chan error, 4)
+	c, err := New(Network, srv.addr(), WithMaxPacketSize(1024),
+		WithErrorHandler(func(e error) { errs <- e }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	call, err := c.Call(ctx, "big", nil, JobNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var serr *protocol.SizeError
+	if _, err = call.Wait(ctx); !errors.As(err, &serr) || string(serr.Handle) != "H:big" {
+		t.Errorf("*protocol.SizeError of H:big expected, %v got.", err)
+	}
+	if err = <-errs; !errors.As(err, &serr) {
+		t.Errorf("*protocol.SizeError expected, %v got.", err)
+	}
+	// The connection goes on.
+	if echo, err := c.Echo([]byte("go")); err != nil || string(echo) != "go" {
+		t.Errorf("%s expected, %s, %v got.", "go", echo, err)
+	}
+	call, err = c.Call(ctx, "small", nil, JobNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := call.Wait(ctx); err != nil || string(data) != "done" {
+		t.Errorf("%s expected, %s, %v got.", "done", data, err)
+	}
+}
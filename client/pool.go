@@ -1,9 +1,11 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"math/rand"
 	"sync"
+	"time"
 )
 
 const (
@@ -53,15 +55,18 @@ type Pool struct {
 	Clients          map[string]*PoolClient
 
 	last string
+	opts []Option
 
 	mutex sync.Mutex
 }
 
 // NewPool returns a new pool.
-func NewPool() (pool *Pool) {
+// The options are applied to every client added to the pool.
+func NewPool(opts ...Option) (pool *Pool) {
 	return &Pool{
 		Clients:          make(map[string]*PoolClient, poolSize),
 		SelectionHandler: SelectWithRate,
+		opts:             opts,
 	}
 }
 
@@ -75,7 +80,7 @@ func (pool *Pool) Add(net, addr string, rate int) (err error) {
 		item.Rate = rate
 	} else {
 		var client *Client
-		client, err = New(net, addr)
+		client, err = New(net, addr, pool.opts...)
 		if err == nil {
 			item = &PoolClient{Client: client, Rate: rate}
 			pool.Clients[addr] = item
@@ -94,8 +99,6 @@ func (pool *Pool) Remove(addr string) {
 func (pool *Pool) Do(funcname string, data []byte,
 	flag byte, h ResponseHandler) (addr, handle string, err error) {
 	client := pool.selectServer()
-	client.Lock()
-	defer client.Unlock()
 	handle, err = client.Do(funcname, data, flag, h)
 	addr = client.addr
 	return
@@ -104,20 +107,95 @@ func (pool *Pool) Do(funcname string, data []byte,
 func (pool *Pool) DoBg(funcname string, data []byte,
 	flag byte) (addr, handle string, err error) {
 	client := pool.selectServer()
-	client.Lock()
-	defer client.Unlock()
 	handle, err = client.DoBg(funcname, data, flag)
 	addr = client.addr
 	return
 }
 
+// DoContext is Do waiting for the job to be created until ctx is done.
+func (pool *Pool) DoContext(ctx context.Context, funcname string, data []byte,
+	flag byte, h ResponseHandler) (addr, handle string, err error) {
+	client := pool.selectServer()
+	handle, err = client.DoContext(ctx, funcname, data, flag, h)
+	addr = client.addr
+	return
+}
+
+// DoBgContext is DoBg waiting for the job to be created until ctx
+// is done.
+func (pool *Pool) DoBgContext(ctx context.Context, funcname string,
+	data []byte, flag byte) (addr, handle string, err error) {
+	client := pool.selectServer()
+	handle, err = client.DoBgContext(ctx, funcname, data, flag)
+	addr = client.addr
+	return
+}
+
+// Call the function in background at the time t.
+func (pool *Pool) DoEpoch(funcname string, data []byte,
+	t time.Time) (addr, handle string, err error) {
+	client := pool.selectServer()
+	handle, err = client.DoEpoch(funcname, data, t)
+	addr = client.addr
+	return
+}
+
+// Call the function in background whenever sched matches.
+func (pool *Pool) DoSched(funcname string, data []byte,
+	sched *Schedule) (addr, handle string, err error) {
+	client := pool.selectServer()
+	handle, err = client.DoSched(funcname, data, sched)
+	addr = client.addr
+	return
+}
+
+// Call the function as a map/reduce job and get a response.
+func (pool *Pool) DoReduce(funcname, reducer string, data []byte,
+	h ResponseHandler) (addr, handle string, err error) {
+	client := pool.selectServer()
+	handle, err = client.DoReduce(funcname, reducer, data, h)
+	addr = client.addr
+	return
+}
+
+// Call the function as a map/reduce job in background.
+func (pool *Pool) DoReduceBg(funcname, reducer string,
+	data []byte) (addr, handle string, err error) {
+	client := pool.selectServer()
+	handle, err = client.DoReduceBg(funcname, reducer, data)
+	addr = client.addr
+	return
+}
+
 // Status gets job status from job server.
 // !!!Not fully tested.!!!
 func (pool *Pool) Status(addr, handle string) (status *Status, err error) {
-	if client, ok := pool.Clients[addr]; ok {
-		client.Lock()
-		defer client.Unlock()
-		status, err = client.Status(handle)
+	return pool.StatusContext(context.Background(), addr, handle)
+}
+
+// StatusContext gets job status from job server, giving up when ctx
+// is done.
+func (pool *Pool) StatusContext(ctx context.Context,
+	addr, handle string) (status *Status, err error) {
+	if client, ok := pool.client(addr); ok {
+		status, err = client.StatusContext(ctx, handle)
+	} else {
+		err = ErrNotFound
+	}
+	return
+}
+
+// StatusUnique gets job status from job server by unique ID.
+func (pool *Pool) StatusUnique(addr, id string) (status *Status, err error) {
+	return pool.StatusUniqueContext(context.Background(), addr, id)
+}
+
+// StatusUniqueContext gets job status by unique ID, giving up when
+// ctx is done.
+func (pool *Pool) StatusUniqueContext(ctx context.Context,
+	addr, id string) (status *Status, err error) {
+	if client, ok := pool.client(addr); ok {
+		status, err = client.StatusUniqueContext(ctx, id)
 	} else {
 		err = ErrNotFound
 	}
@@ -126,33 +204,49 @@ func (pool *Pool) Status(addr, handle string) (status *Status, err error) {
 
 // Send a something out, get the samething back.
 func (pool *Pool) Echo(addr string, data []byte) (echo []byte, err error) {
+	return pool.EchoContext(context.Background(), addr, data)
+}
+
+// EchoContext is Echo giving up when ctx is done.
+func (pool *Pool) EchoContext(ctx context.Context, addr string,
+	data []byte) (echo []byte, err error) {
 	var client *PoolClient
 	if addr == "" {
 		client = pool.selectServer()
 	} else {
 		var ok bool
-		if client, ok = pool.Clients[addr]; !ok {
+		if client, ok = pool.client(addr); !ok {
 			err = ErrNotFound
 			return
 		}
 	}
-	client.Lock()
-	defer client.Unlock()
-	echo, err = client.Echo(data)
+	echo, err = client.EchoContext(ctx, data)
 	return
 }
 
 // Close
 func (pool *Pool) Close() (err map[string]error) {
 	err = make(map[string]error)
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
 	for _, c := range pool.Clients {
 		err[c.addr] = c.Close()
 	}
 	return
 }
 
+// client returns the client of the server addr.
+func (pool *Pool) client(addr string) (client *PoolClient, ok bool) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	client, ok = pool.Clients[addr]
+	return
+}
+
 // selecting server
 func (pool *Pool) selectServer() (client *PoolClient) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
 	for client == nil {
 		addr := pool.SelectionHandler(pool.Clients, pool.last)
 		var ok bool
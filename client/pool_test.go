@@ -1,7 +1,12 @@
 package client
 
 import (
+	"context"
+	"net"
 	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
 )
 
 var (
@@ -137,3 +142,37 @@ func TestPoolClose(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestPoolContext(t *testing.T) {
+	// a job server which only creates jobs
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type == protocol.SubmitJob {
+			writeFragmented(conn, 64,
+				protocol.NewResponse(protocol.JobCreated, []byte("H:1")))
+		}
+	})
+	defer srv.close()
+	p := NewPool()
+	if err := p.Add(Network, srv.addr(), 1); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.EchoContext(ctx, "", []byte(TestStr)); err != context.DeadlineExceeded {
+		t.Errorf("%v expected, %v got.", context.DeadlineExceeded, err)
+	}
+	if _, err := p.StatusContext(ctx, "not exists", "H:1"); err != ErrNotFound {
+		t.Errorf("%v expected, %v got.", ErrNotFound, err)
+	}
+	if _, err := p.StatusUniqueContext(ctx, "not exists", "1"); err != ErrNotFound {
+		t.Errorf("%v expected, %v got.", ErrNotFound, err)
+	}
+	addr, handle, err := p.Do("echo", []byte(TestStr), JobNormal, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != srv.addr() || handle != "H:1" {
+		t.Errorf("%s %s expected, %s %s got.", srv.addr(), "H:1", addr, handle)
+	}
+}
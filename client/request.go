@@ -1,42 +1,33 @@
 package client
 
 import (
-	"encoding/binary"
+	"strconv"
+
+	"github.com/mikespook/gearman-go/protocol"
 )
 
-// Request from client
-type request struct {
-	DataType uint32
-	Data     []byte
+// The request goes back to the pool once written.
+func getRequest(t protocol.PacketType, args ...[]byte) (req *protocol.Packet) {
+	return protocol.GetPacket(protocol.Req, t, args...)
+}
+
+func getJob(t protocol.PacketType, id string, funcname, data []byte) (req *protocol.Packet) {
+	return getRequest(t, funcname, []byte(id), data)
 }
 
-// Encode a Request to byte slice
-func (req *request) Encode() (data []byte) {
-	l := len(req.Data)        // length of data
-	tl := l + minPacketLength // add 12 bytes head
-	data = getBuffer(tl)
-	copy(data[:4], reqStr)
-	binary.BigEndian.PutUint32(data[4:8], req.DataType)
-	binary.BigEndian.PutUint32(data[8:12], uint32(l))
-	copy(data[minPacketLength:], req.Data)
-	return
+func getEpochJob(id string, funcname, data []byte, epoch int64) (req *protocol.Packet) {
+	return getRequest(protocol.SubmitJobEpoch, funcname, []byte(id),
+		[]byte(strconv.FormatInt(epoch, 10)), data)
 }
 
-func getRequest() (req *request) {
-	// TODO add a pool
-	req = &request{}
-	return
+func getSchedJob(id string, funcname, data []byte, sched *Schedule) (req *protocol.Packet) {
+	return getRequest(protocol.SubmitJobSched, funcname, []byte(id),
+		[]byte(sched.Minute), []byte(sched.Hour), []byte(sched.DayOfMonth),
+		[]byte(sched.Month), []byte(sched.DayOfWeek), data)
 }
 
-func getJob(id string, funcname, data []byte) (req *request) {
-	req = getRequest()
-	a := len(funcname)
-	b := len(id)
-	c := len(data)
-	l := a + b + c + 2
-	req.Data = getBuffer(l)
-	copy(req.Data[0:a], funcname)
-	copy(req.Data[a+1:a+b+1], []byte(id))
-	copy(req.Data[a+b+2:], data)
-	return
+// The aggregator argument is left empty, gearmand uses the reducer
+// for it.
+func getReduceJob(t protocol.PacketType, id string, funcname, reducer, data []byte) (req *protocol.Packet) {
+	return getRequest(t, funcname, []byte(id), reducer, nil, data)
 }
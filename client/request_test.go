@@ -0,0 +1,44 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+func TestRequestEncode(t *testing.T) {
+	cases := map[string]struct {
+		req *protocol.Packet
+		src string
+	}{
+		"SUBMIT_JOB": {
+			req: getJob(protocol.SubmitJob, "b", []byte("a"), []byte("xyz")),
+			src: "\x00REQ\x00\x00\x00\x07\x00\x00\x00\x07a\x00b\x00xyz",
+		},
+		"SUBMIT_JOB_EPOCH": {
+			req: getEpochJob("b", []byte("a"), []byte("xyz"), 1500000000),
+			src: "\x00REQ\x00\x00\x00\x24\x00\x00\x00\x12a\x00b\x001500000000\x00xyz",
+		},
+		"SUBMIT_JOB_SCHED": {
+			req: getSchedJob("b", []byte("a"), []byte("xyz"), &Schedule{
+				Minute: "30", Hour: "2", DayOfWeek: "1",
+			}),
+			src: "\x00REQ\x00\x00\x00\x23\x00\x00\x00\x10a\x00b\x0030\x002\x00\x00\x001\x00xyz",
+		},
+		"SUBMIT_REDUCE_JOB": {
+			req: getReduceJob(protocol.SubmitReduceJob, "b", []byte("a"),
+				[]byte("r"), []byte("xyz")),
+			src: "\x00REQ\x00\x00\x00\x25\x00\x00\x00\x0Aa\x00b\x00r\x00\x00xyz",
+		},
+	}
+	for k, v := range cases {
+		data, err := v.req.Encode()
+		if err != nil {
+			t.Errorf("%s: %s", k, err)
+		}
+		if bytes.Compare([]byte(v.src), data) != 0 {
+			t.Errorf("%s: %X expected, %X got.", k, v.src, data)
+		}
+	}
+}
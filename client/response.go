@@ -2,36 +2,50 @@ package client
 
 import (
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"strconv"
+	"sync"
+
+	"github.com/mikespook/gearman-go/protocol"
 )
 
 // Response handler
 type ResponseHandler func(*Response)
 
-// response
+// Response from the job server.
+//
+// Responses and their Data and UID are pooled: they are only valid
+// until the ResponseHandler returns. Copy anything that is needed
+// afterwards.
+//
+// When the connection is lost, the handler of every outstanding job
+// gets a WORK_FAIL whose Result is a *LostConnError.
 type Response struct {
-	DataType  uint32
+	DataType  protocol.PacketType
 	Data, UID []byte
 	Handle    string
+
+	p   *protocol.Packet
+	err error // the connection was lost, or the packet too large
+	gen int   // generation of the lost connection
 }
 
 // Extract the Response's result.
 // if data == nil, err != nil, then worker failing to execute job
 // if data != nil, err != nil, then worker has a exception
 // if data != nil, err == nil, then worker complate job
-// after calling this method, the Response.Handle will be filled
 func (resp *Response) Result() (data []byte, err error) {
+	if resp.err != nil {
+		return nil, resp.err
+	}
 	switch resp.DataType {
-	case dtWorkFail:
-		resp.Handle = string(resp.Data)
+	case protocol.WorkFail:
 		err = ErrWorkFail
 		return
-	case dtWorkException:
+	case protocol.WorkException:
 		err = ErrWorkException
 		fallthrough
-	case dtWorkComplete:
+	case protocol.WorkComplete:
 		data = resp.Data
 	default:
 		err = ErrDataType
@@ -41,13 +55,13 @@ func (resp *Response) Result() (data []byte, err error) {
 
 // Extract the job's update
 func (resp *Response) Update() (data []byte, err error) {
-	if resp.DataType != dtWorkData &&
-		resp.DataType != dtWorkWarning {
+	if resp.DataType != protocol.WorkData &&
+		resp.DataType != protocol.WorkWarning {
 		err = ErrDataType
 		return
 	}
 	data = resp.Data
-	if resp.DataType == dtWorkWarning {
+	if resp.DataType == protocol.WorkWarning {
 		err = ErrWorkWarning
 	}
 	return
@@ -55,50 +69,35 @@ func (resp *Response) Update() (data []byte, err error) {
 
 // Decode a job from byte slice
 func decodeResponse(data []byte) (resp *Response, l int, err error) {
-	a := len(data)
-	if a < minPacketLength { // valid package should not less 12 bytes
-		err = fmt.Errorf("Invalid data: %v", data)
-		return
-	}
-	dl := int(binary.BigEndian.Uint32(data[8:12]))
-	if a < minPacketLength+dl {
-		err = fmt.Errorf("Invalid data: %v", data)
-		return
-	}
-	dt := data[minPacketLength : dl+minPacketLength]
-	if len(dt) != int(dl) { // length not equal
-		err = fmt.Errorf("Invalid data: %v", data)
+	var p *protocol.Packet
+	if p, l, err = protocol.Decode(data); err != nil {
 		return
 	}
+	resp = newResponse(p)
+	return
+}
+
+// Convert a decoded packet to response, the response owns the packet
+func newResponse(p *protocol.Packet) (resp *Response) {
 	resp = getResponse()
-	resp.DataType = binary.BigEndian.Uint32(data[4:8])
-	switch resp.DataType {
-	case dtJobCreated:
-		resp.Handle = string(dt)
-	case dtStatusRes, dtWorkData, dtWorkWarning, dtWorkStatus,
-		dtWorkComplete, dtWorkException:
-		s := bytes.SplitN(dt, []byte{'\x00'}, 2)
-		if len(s) >= 2 {
-			resp.Handle = string(s[0])
-			resp.Data = s[1]
-		} else {
-			err = fmt.Errorf("Invalid data: %v", data)
-			return
-		}
-	case dtWorkFail:
-		s := bytes.SplitN(dt, []byte{'\x00'}, 2)
-		if len(s) >= 1 {
-			resp.Handle = string(s[0])
-		} else {
-			err = fmt.Errorf("Invalid data: %v", data)
-			return
-		}
-	case dtEchoRes:
-		fallthrough
+	resp.p = p
+	resp.DataType = p.Type
+	switch p.Type {
+	case protocol.JobCreated, protocol.WorkFail:
+		resp.Handle = string(p.Arg(0))
+	case protocol.WorkData, protocol.WorkWarning, protocol.WorkComplete,
+		protocol.WorkException:
+		resp.Handle = string(p.Arg(0))
+		resp.Data = p.Arg(1)
+	case protocol.StatusRes, protocol.WorkStatus:
+		resp.Handle = string(p.Arg(0))
+		resp.Data = (&protocol.Packet{Args: p.Args[1:]}).Body()
+	case protocol.StatusResUnique:
+		resp.UID = p.Arg(0)
+		resp.Data = (&protocol.Packet{Args: p.Args[1:]}).Body()
 	default:
-		resp.Data = dt
+		resp.Data = p.Body()
 	}
-	l = dl + minPacketLength
 	return
 }
 
@@ -149,8 +148,67 @@ func (resp *Response) _status() (status *Status, err error) {
 	return
 }
 
+// status-by-unique-id handler
+func (resp *Response) _statusUnique() (status *Status, err error) {
+	data := bytes.SplitN(resp.Data, []byte{'\x00'}, 5)
+	if len(data) != 5 {
+		err = fmt.Errorf("Invalid data: %v", resp.Data)
+		return
+	}
+	status = &Status{}
+	status.UniqueId = string(resp.UID)
+	status.Known = (len(data[0]) > 0 && data[0][0] == '1')
+	status.Running = (len(data[1]) > 0 && data[1][0] == '1')
+	status.Numerator, err = strconv.ParseUint(string(data[2]), 10, 0)
+	if err != nil {
+		err = fmt.Errorf("Invalid Integer: %s", data[2])
+		return
+	}
+	status.Denominator, err = strconv.ParseUint(string(data[3]), 10, 0)
+	if err != nil {
+		err = fmt.Errorf("Invalid Integer: %s", data[3])
+		return
+	}
+	status.Waiting, err = strconv.ParseUint(string(data[4]), 10, 0)
+	if err != nil {
+		err = fmt.Errorf("Invalid Integer: %s", data[4])
+		return
+	}
+	return
+}
+
+var responsePool = sync.Pool{
+	New: func() interface{} {
+		return &Response{}
+	},
+}
+
 func getResponse() (resp *Response) {
-	// TODO add a pool
-	resp = &Response{}
+	return responsePool.Get().(*Response)
+}
+
+// The response telling the connection gen was lost
+func lostResponse(err error, gen int) (resp *Response) {
+	resp = getResponse()
+	resp.err = err
+	resp.gen = gen
 	return
 }
+
+// The WORK_FAIL given to the jobs of a packet over the size limit
+func tooLargeResponse(e *protocol.SizeError) (resp *Response) {
+	resp = getResponse()
+	resp.DataType = protocol.WorkFail
+	resp.Handle = string(e.Handle)
+	resp.err = e
+	return
+}
+
+// Put the response and its packet back to the pools
+func (resp *Response) release() {
+	if resp.p != nil {
+		resp.p.Release()
+	}
+	*resp = Response{}
+	responsePool.Put(resp)
+}
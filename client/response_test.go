@@ -0,0 +1,30 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+func TestResponseStatusUnique(t *testing.T) {
+	src := "\x00RES\x00\x00\x00\x2A\x00\x00\x00\x0Ea\x001\x000\x0050\x00100\x003"
+	resp, l, err := decodeResponse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != len(src) {
+		t.Errorf("Length: %d expected, %d got.", len(src), l)
+	}
+	if resp.DataType != protocol.StatusResUnique {
+		t.Errorf("DataType: %d expected, %d got.", protocol.StatusResUnique, resp.DataType)
+	}
+	status, err := resp._statusUnique()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Status{UniqueId: "a", Known: true, Running: false,
+		Numerator: 50, Denominator: 100, Waiting: 3}
+	if *status != expected {
+		t.Errorf("Status: %+v expected, %+v got.", expected, *status)
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy tells when and how a foreground job is run again, see
+// (*Client).CallRetry. Every attempt is submitted with the same
+// unique ID, so the job server still coalesces them.
+type RetryPolicy struct {
+	MaxAttempts int     // attempts in all, the first one included
+	Backoff     Backoff // delay before each retry, its MaxAttempts is not used
+
+	OnFail      bool // retry after WORK_FAIL
+	OnException bool // retry after WORK_EXCEPTION
+	OnLostConn  bool // retry when the connection is lost
+	// Retry, if set, also retries after the final response it is
+	// true for, WORK_COMPLETE included. The response is only valid
+	// until it returns.
+	Retry func(*Response) bool
+}
+
+// retry tells if the attempt ending with call and err is retried.
+func (policy *RetryPolicy) retry(call *Call, err error) bool {
+	judged := call != nil && call.judged
+	switch {
+	case err == nil:
+		return judged
+	case errors.Is(err, ErrLostConn):
+		return policy.OnLostConn
+	case errors.Is(err, ErrWorkFail):
+		return policy.OnFail || judged
+	case errors.Is(err, ErrWorkException):
+		return policy.OnException || judged
+	}
+	return false
+}
+
+func (policy *RetryPolicy) judge() func(*Response) bool {
+	if policy == nil {
+		return nil
+	}
+	return policy.Retry
+}
+
+// attempts runs attempt until it is not retried, the attempts run
+// out or ctx is done. A nil policy runs it once.
+func (policy *RetryPolicy) attempts(ctx context.Context,
+	attempt func(n int) (*Call, error)) (data []byte, err error) {
+	if policy == nil {
+		policy = &RetryPolicy{}
+	}
+	for n := 1; ; n++ {
+		var call *Call
+		if call, err = attempt(n); err == nil {
+			data, err = call.Wait(ctx)
+		}
+		if n >= policy.MaxAttempts || !policy.retry(call, err) {
+			return
+		}
+		select {
+		case <-time.After(policy.Backoff.Delay(n)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// CallRetry calls the function, retrying as policy says, and waits
+// for the result of the last attempt.
+// flag can be set to: JobLow, JobNormal and JobHigh
+func (client *Client) CallRetry(ctx context.Context, funcname string,
+	data []byte, flag byte, policy *RetryPolicy) (result []byte, err error) {
+	return client.CallRetryWithId(ctx, funcname, data, flag, client.id(funcname, data), policy)
+}
+
+// CallRetryWithId calls the function, retrying as policy says.
+func (client *Client) CallRetryWithId(ctx context.Context, funcname string,
+	data []byte, flag byte, id string,
+	policy *RetryPolicy) (result []byte, err error) {
+	return policy.attempts(ctx, func(int) (*Call, error) {
+		return client.callWithId(ctx, funcname, data, flag, id, policy.judge())
+	})
+}
+
+// CallRetry calls the function, retrying as policy says. Every
+// attempt goes to the server SelectionHandler selects, which is told
+// the last one, so retries can move to another server. addr is the
+// server of the last attempt.
+func (pool *Pool) CallRetry(ctx context.Context, funcname string, data []byte,
+	flag byte, policy *RetryPolicy) (addr string, result []byte, err error) {
+	var id string
+	result, err = policy.attempts(ctx, func(n int) (*Call, error) {
+		client := pool.selectServer()
+		if n == 1 {
+			id = client.id(funcname, data)
+		}
+		addr = client.addr
+		return client.callWithId(ctx, funcname, data, flag, id, policy.judge())
+	})
+	return
+}
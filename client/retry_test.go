@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+// A job server failing the first attempts of every unique ID as the
+// function name says: "fail", "again" (completed with "again") or
+// "drop" (dropping the connection).
+type retryServer struct {
+	*testServer
+	mutex    sync.Mutex
+	attempts map[string]int
+}
+
+func newRetryServer(t *testing.T, failures int) *retryServer {
+	srv := &retryServer{attempts: make(map[string]int)}
+	srv.testServer = newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type == protocol.EchoReq {
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.EchoRes, req.Arg(0)))
+		}
+		if req.Type != protocol.SubmitJob {
+			return
+		}
+		fn, id := string(req.Arg(0)), string(req.Arg(1))
+		srv.mutex.Lock()
+		srv.attempts[id]++
+		n := srv.attempts[id]
+		srv.mutex.Unlock()
+		h := []byte("H:" + id)
+		result := protocol.NewResponse(protocol.WorkComplete, h, []byte("done"))
+		if n <= failures {
+			switch fn {
+			case "fail":
+				result = protocol.NewResponse(protocol.WorkFail, h)
+			case "again":
+				result = protocol.NewResponse(protocol.WorkComplete, h, []byte("again"))
+			case "drop":
+				writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h))
+				conn.Close()
+				return
+			}
+		}
+		writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h), result)
+	})
+	return srv
+}
+
+func (srv *retryServer) attemptsOf(id string) int {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.attempts[id]
+}
+
+func TestClientCallRetry(t *testing.T) {
+	srv := newRetryServer(t, 2)
+	defer srv.close()
+	c, err := New(Network, srv.addr(), WithBackoff(Backoff{
+		Initial:    time.Millisecond,
+		Multiplier: 1,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	backoff := Backoff{Initial: time.Millisecond, Multiplier: 2}
+	cases := []struct {
+		fn, id string
+		policy *RetryPolicy
+		err    error
+	}{
+		{"fail", "fail-1", &RetryPolicy{MaxAttempts: 3, Backoff: backoff, OnFail: true}, nil},
+		{"fail", "fail-2", &RetryPolicy{MaxAttempts: 2, Backoff: backoff, OnFail: true}, ErrWorkFail},
+		{"fail", "fail-3", &RetryPolicy{MaxAttempts: 3, Backoff: backoff}, ErrWorkFail},
+		{"fail", "fail-4", nil, ErrWorkFail},
+		{"drop", "drop-1", &RetryPolicy{MaxAttempts: 3, OnLostConn: true,
+			Backoff: Backoff{Initial: 50 * time.Millisecond, Multiplier: 1}}, nil},
+		{"again", "again-1", &RetryPolicy{MaxAttempts: 3, Backoff: backoff,
+			Retry: func(resp *Response) bool {
+				return string(resp.Data) == "again"
+			}}, nil},
+	}
+	for _, tc := range cases {
+		// connected again after dropping
+		for {
+			if _, err := c.EchoContext(ctx, nil); !errors.Is(err, ErrLostConn) {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		data, err := c.CallRetryWithId(ctx, tc.fn, nil, JobNormal, tc.id, tc.policy)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: %v expected, %v got.", tc.id, tc.err, err)
+		}
+		if tc.err == nil && string(data) != "done" {
+			t.Errorf("%s: %s expected, %s got.", tc.id, "done", data)
+		}
+		expected := 3
+		if tc.policy == nil {
+			expected = 1
+		} else if tc.err != nil {
+			expected = tc.policy.MaxAttempts
+			if !tc.policy.OnFail {
+				expected = 1
+			}
+		}
+		if n := srv.attemptsOf(tc.id); n != expected {
+			t.Errorf("%s: %d attempts with the same ID expected, %d got.",
+				tc.id, expected, n)
+		}
+	}
+}
+
+func TestPoolCallRetry(t *testing.T) {
+	bad := newRetryServer(t, 1<<30)
+	defer bad.close()
+	good := newRetryServer(t, 0)
+	defer good.close()
+	p := NewPool()
+	// start with the bad one, then anything but the last
+	p.SelectionHandler = func(clients map[string]*PoolClient, last string) string {
+		if last == "" {
+			return bad.addr()
+		}
+		for addr := range clients {
+			if addr != last {
+				return addr
+			}
+		}
+		return last
+	}
+	for _, srv := range []*retryServer{bad, good} {
+		if err := p.Add(Network, srv.addr(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer p.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addr, data, err := p.CallRetry(ctx, "fail", nil, JobNormal,
+		&RetryPolicy{MaxAttempts: 2, OnFail: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != good.addr() || string(data) != "done" {
+		t.Errorf("%s %s expected, %s %s got.", good.addr(), "done", addr, data)
+	}
+}
@@ -0,0 +1,9 @@
+package client
+
+// Schedule is a cron-like time specification for jobs submitted
+// with SUBMIT_JOB_SCHED. Each field takes the value used in crontab
+// (e.g. Minute "30", DayOfWeek "1"); leave a field empty to match
+// any value.
+type Schedule struct {
+	Minute, Hour, DayOfMonth, Month, DayOfWeek string
+}
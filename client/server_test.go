@@ -0,0 +1,156 @@
+package client
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+// A fake job server for unit tests. The handler is called with
+// every request and writes the responses itself.
+type testServer struct {
+	l       net.Listener
+	handler func(conn net.Conn, req *protocol.Packet)
+
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+func newTestServer(t *testing.T,
+	handler func(conn net.Conn, req *protocol.Packet)) *testServer {
+	return newTLSTestServer(t, nil, handler)
+}
+
+// A fake job server speaking TLS with config, nil for plain TCP.
+func newTLSTestServer(t *testing.T, config *tls.Config,
+	handler func(conn net.Conn, req *protocol.Packet)) *testServer {
+	l, err := net.Listen(Network, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config != nil {
+		l = tls.NewListener(l, config)
+	}
+	srv := &testServer{l: l, handler: handler}
+	go srv.serve()
+	return srv
+}
+
+// Configs of a server and a client trusting each other by a
+// self-signed certificate for 127.0.0.1.
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gearman-go test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	server = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	client = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}
+	return
+}
+
+func (srv *testServer) addr() string {
+	return srv.l.Addr().String()
+}
+
+func (srv *testServer) serve() {
+	for {
+		conn, err := srv.l.Accept()
+		if err != nil {
+			return
+		}
+		srv.mutex.Lock()
+		srv.conns = append(srv.conns, conn)
+		srv.mutex.Unlock()
+		go func() {
+			defer conn.Close()
+			dec := protocol.NewDecoder(bufio.NewReader(conn))
+			for {
+				req, err := dec.Decode()
+				if err != nil {
+					return
+				}
+				srv.handler(conn, req)
+			}
+		}()
+	}
+}
+
+// The number of connections accepted and not dropped.
+func (srv *testServer) count() int {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return len(srv.conns)
+}
+
+// Drop all connections, the listener keeps running.
+func (srv *testServer) drop() {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	for _, conn := range srv.conns {
+		conn.Close()
+	}
+	srv.conns = nil
+}
+
+func (srv *testServer) close() {
+	srv.l.Close()
+	srv.drop()
+}
+
+// Write the packets in pieces of n bytes.
+func writeFragmented(conn net.Conn, n int, packets ...*protocol.Packet) {
+	var data []byte
+	for _, p := range packets {
+		buf, _ := p.Encode()
+		data = append(data, buf...)
+	}
+	for i := 0; i < len(data); i += n {
+		j := i + n
+		if j > len(data) {
+			j = len(data)
+		}
+		if _, err := conn.Write(data[i:j]); err != nil {
+			return
+		}
+	}
+}
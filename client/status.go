@@ -8,4 +8,8 @@ type Status struct {
 	Handle                 string
 	Known, Running         bool
 	Numerator, Denominator uint64
+
+	// Only filled by StatusUnique
+	UniqueId string
+	Waiting  uint64 // number of clients waiting for the job
 }
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+// Default limit of the output a Stream holds unread, see
+// WithStreamBuffer.
+const DefaultStreamBuffer = 16 << 20
+
+// Stream is a foreground job submitted by (*Client).Stream, reading
+// the WORK_DATA of the job as it comes, without holding the whole
+// output. The chunks not read yet are kept, up to the limit set by
+// WithStreamBuffer, so keep reading. By default a stream read too
+// slowly fails with ErrStreamFull once what it holds is read, while
+// the job goes on; the connection is not held up for it. With
+// WithStreamBackpressure the connection waits for the reader instead.
+type Stream struct {
+	Handle string
+
+	client *Client
+	job    *job
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	chunks [][]byte
+	size   int   // bytes in chunks
+	err    error // io.EOF once complete
+}
+
+func newStream(client *Client) *Stream {
+	s := &Stream{client: client}
+	s.cond = sync.NewCond(&s.mutex)
+	return s
+}
+
+// handle is the ResponseHandler of the stream. The responses are
+// pooled, so the chunks are copied.
+func (s *Stream) handle(resp *Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return // full, what comes next is dropped
+	}
+	switch resp.DataType {
+	case protocol.WorkData, protocol.WorkComplete:
+		if s.client.streamBackpressure {
+			if s.waitRoom(len(resp.Data)); s.err != nil {
+				return // closed meanwhile
+			}
+		} else if s.size+len(resp.Data) > s.client.streamBuffer {
+			s.err = ErrStreamFull
+			break
+		}
+		if len(resp.Data) > 0 {
+			s.chunks = append(s.chunks, append([]byte(nil), resp.Data...))
+			s.size += len(resp.Data)
+		}
+		if resp.DataType == protocol.WorkComplete {
+			s.err = io.EOF
+		}
+	case protocol.WorkFail, protocol.WorkException:
+		s.err = workError(resp)
+	default:
+		return
+	}
+	s.cond.Broadcast()
+}
+
+// waitRoom holds up the connection until n more bytes fit in the
+// buffer, or the stream or the client is closed. A chunk larger than
+// the buffer goes alone. The caller holds s.mutex.
+func (s *Stream) waitRoom(n int) {
+	full := func() bool {
+		return s.size > 0 && s.size+n > s.client.streamBuffer && s.err == nil
+	}
+	if !full() {
+		return
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.client.closed:
+			s.mutex.Lock()
+			s.cond.Broadcast()
+			s.mutex.Unlock()
+		case <-done:
+		}
+	}()
+	for full() {
+		select {
+		case <-s.client.closed:
+			return
+		default:
+		}
+		s.cond.Wait()
+	}
+}
+
+// Read reads the output of the job in order, the data of WORK_COMPLETE
+// last. It returns io.EOF once the job is complete, or a *WorkError if
+// it failed, or a *LostConnError, or ErrStreamFull.
+func (s *Stream) Read(p []byte) (n int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for len(s.chunks) == 0 && s.err == nil {
+		s.cond.Wait()
+	}
+	if len(s.chunks) == 0 {
+		return 0, s.err
+	}
+	n = copy(p, s.chunks[0])
+	s.size -= n
+	s.cond.Broadcast() // there is room
+	if n == len(s.chunks[0]) {
+		s.chunks[0] = nil
+		s.chunks = s.chunks[1:]
+	} else {
+		s.chunks[0] = s.chunks[0][n:]
+	}
+	return
+}
+
+// Close stops reading, the job is abandoned locally if not done.
+// Other jobs sharing the handle, eg. submitted with the same unique
+// ID, are left running.
+func (s *Stream) Close() error {
+	s.mutex.Lock()
+	if s.err == nil {
+		s.err = ErrAbandoned
+	}
+	s.cond.Broadcast() // the connection may wait for room
+	s.mutex.Unlock()
+	if s.client.jobs.removeJob(s.job) {
+		s.job.fail(ErrAbandoned)
+	}
+	return nil
+}
+
+// Stream calls the function and returns once the job is created, Read
+// the output. ctx bounds the submission only.
+// flag can be set to: JobLow, JobNormal and JobHigh
+//
+// The reader must keep up: by default the stream fails with
+// ErrStreamFull when more than the buffer of WithStreamBuffer is
+// unread, and the output of the job is lost. A reader slower than
+// the network, eg. uploading the output, wants WithStreamBackpressure
+// or a larger buffer.
+func (client *Client) Stream(ctx context.Context, funcname string,
+	data []byte, flag byte) (stream *Stream, err error) {
+	return client.StreamWithId(ctx, funcname, data, flag, client.id(funcname, data))
+}
+
+// StreamWithId calls the function with the unique ID and returns
+// once the job is created.
+func (client *Client) StreamWithId(ctx context.Context, funcname string,
+	data []byte, flag byte, id string) (stream *Stream, err error) {
+	if len(id) == 0 {
+		return nil, ErrInvalidId
+	}
+	stream = newStream(client)
+	req := getJob(jobType(flag), id, []byte(funcname), data)
+	if stream.Handle, stream.job, err = client.submitJob(ctx, req, stream.handle); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Stream calls the function on a selected server, Read the output.
+func (pool *Pool) Stream(ctx context.Context, funcname string,
+	data []byte, flag byte) (addr string, stream *Stream, err error) {
+	client := pool.selectServer()
+	stream, err = client.Stream(ctx, funcname, data, flag)
+	addr = client.addr
+	return
+}
@@ -0,0 +1,263 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+func TestClientStream(t *testing.T) {
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.SubmitJob {
+			return
+		}
+		h := []byte("H:" + string(req.Arg(0)))
+		packets := []*protocol.Packet{
+			protocol.NewResponse(protocol.JobCreated, h),
+			protocol.NewResponse(protocol.WorkData, h, []byte("ab")),
+			protocol.NewResponse(protocol.WorkStatus, h, []byte("1"), []byte("2")),
+			protocol.NewResponse(protocol.WorkData, h, []byte("cde")),
+		}
+		switch string(req.Arg(0)) {
+		case "fail":
+			packets = append(packets, protocol.NewResponse(protocol.WorkFail, h))
+		case "exception":
+			packets = append(packets,
+				protocol.NewResponse(protocol.WorkException, h, []byte("oops")))
+		case "complete":
+			packets = append(packets,
+				protocol.NewResponse(protocol.WorkComplete, h, []byte("f")))
+		}
+		writeFragmented(conn, 3, packets...)
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	cases := map[string]struct {
+		data string
+		err  error
+	}{
+		"complete":  {"abcdef", nil},
+		"fail":      {"abcde", ErrWorkFail},
+		"exception": {"abcde", ErrWorkException},
+	}
+	for fn, expected := range cases {
+		stream, err := c.Stream(ctx, fn, nil, JobNormal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(stream)
+		if string(data) != expected.data || !errors.Is(err, expected.err) {
+			t.Errorf("%s: %s, %v expected, %s, %v got.", fn, expected.data,
+				expected.err, data, err)
+		}
+	}
+
+	// a job never done
+	stream, err := c.Stream(ctx, "running", nil, JobNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1)
+	for _, expected := range "abcde" {
+		if n, err := stream.Read(buf); n != 1 || err != nil || rune(buf[0]) != expected {
+			t.Fatalf("%c expected, %q, %v got.", expected, buf[:n], err)
+		}
+	}
+	stream.Close()
+	if _, err = stream.Read(buf); !errors.Is(err, ErrAbandoned) {
+		t.Errorf("%v expected, %v got.", ErrAbandoned, err)
+	}
+}
+
+func TestClientStreamFull(t *testing.T) {
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.SubmitJob {
+			return
+		}
+		h := []byte("H:1")
+		writeFragmented(conn, 3,
+			protocol.NewResponse(protocol.JobCreated, h),
+			protocol.NewResponse(protocol.WorkData, h, []byte("ab")),
+			protocol.NewResponse(protocol.WorkData, h, []byte("cde")),
+			protocol.NewResponse(protocol.WorkData, h, []byte("fg")),
+			protocol.NewResponse(protocol.WorkComplete, h, []byte("h")))
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr(), WithStreamBuffer(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream, err := c.Stream(ctx, "full", nil, JobNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	data, err := io.ReadAll(stream)
+	if string(data) != "abcde" || err != ErrStreamFull {
+		t.Errorf("%s, %v expected, %s, %v got.", "abcde", ErrStreamFull, data, err)
+	}
+}
+
+func TestClientStreamLarge(t *testing.T) {
+	// an output of 320MB in chunks of 1MB
+	const chunks, chunkSize = 320, 1 << 20
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		if req.Type != protocol.SubmitJob {
+			return
+		}
+		h := append([]byte(nil), req.Arg(1)...)
+		writeFragmented(conn, 64, protocol.NewResponse(protocol.JobCreated, h))
+		chunk, _ := protocol.NewResponse(protocol.WorkData, h,
+			make([]byte, chunkSize)).Encode()
+		for i := 0; i < chunks; i++ {
+			if _, err := conn.Write(chunk); err != nil {
+				return
+			}
+		}
+		writeFragmented(conn, 64, protocol.NewResponse(protocol.WorkComplete, h, nil))
+	})
+	defer srv.close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Read once the job is done: what is over the buffer is lost.
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	stream, err := c.StreamWithId(ctx, "large", nil, JobNormal, "H:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	for len(c.Jobs()) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	n, err := io.Copy(io.Discard, stream)
+	if n != DefaultStreamBuffer || err != ErrStreamFull {
+		t.Errorf("%d, %v expected, %d, %v got.", DefaultStreamBuffer, ErrStreamFull, n, err)
+	}
+
+	// With backpressure the connection waits for the reader.
+	c, err = New(Network, srv.addr(), WithStreamBackpressure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if stream, err = c.StreamWithId(ctx, "large", nil, JobNormal, "H:2"); err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	time.Sleep(50 * time.Millisecond) // a slow reader
+	stream.mutex.Lock()
+	size := stream.size
+	stream.mutex.Unlock()
+	if size > DefaultStreamBuffer {
+		t.Errorf("At most %d bytes buffered expected, %d got.", DefaultStreamBuffer, size)
+	}
+	if n, err = io.Copy(io.Discard, stream); n != chunks*chunkSize || err != nil {
+		t.Errorf("%d, %v expected, %d, %v got.", chunks*chunkSize, nil, n, err)
+	}
+}
+
+func TestClientStreamBackpressureClose(t *testing.T) {
+	// The connection is held up by a full stream until it is closed.
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		switch req.Type {
+		case protocol.SubmitJob:
+			h := []byte("H:1")
+			writeFragmented(conn, 64,
+				protocol.NewResponse(protocol.JobCreated, h),
+				protocol.NewResponse(protocol.WorkData, h, []byte("abc")),
+				protocol.NewResponse(protocol.WorkData, h, []byte("def")))
+		case protocol.EchoReq:
+			writeFragmented(conn, 64, protocol.NewResponse(protocol.EchoRes, req.Arg(0)))
+		}
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr(), WithStreamBuffer(4), WithStreamBackpressure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream, err := c.Stream(ctx, "fn", nil, JobNormal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echoed := make(chan error, 1)
+	go func() {
+		_, err := c.EchoContext(ctx, []byte("go"))
+		echoed <- err
+	}()
+	select {
+	case err = <-echoed:
+		t.Fatalf("The echo expected to wait for the stream, %v got.", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	stream.Close()
+	if err = <-echoed; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientStreamCloseCoalesced(t *testing.T) {
+	// The job completes once the stream sharing its handle is closed,
+	// the ECHO_REQ tells when.
+	srv := newTestServer(t, func(conn net.Conn, req *protocol.Packet) {
+		h := []byte("H:1")
+		switch req.Type {
+		case protocol.SubmitJob:
+			writeFragmented(conn, 3, protocol.NewResponse(protocol.JobCreated, h))
+		case protocol.EchoReq:
+			writeFragmented(conn, 3,
+				protocol.NewResponse(protocol.WorkComplete, h, []byte("done")),
+				protocol.NewResponse(protocol.EchoRes, req.Arg(0)))
+		}
+	})
+	defer srv.close()
+	c, err := New(Network, srv.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	call, err := c.CallWithId(ctx, "fn", nil, JobNormal, "same")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := c.StreamWithId(ctx, "fn", nil, JobNormal, "same")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	if _, err = stream.Read(make([]byte, 1)); !errors.Is(err, ErrAbandoned) {
+		t.Errorf("%v expected, %v got.", ErrAbandoned, err)
+	}
+	if jobs := c.Jobs(); len(jobs) != 1 {
+		t.Errorf("The call in flight expected, %+v got.", jobs)
+	}
+	if _, err = c.Echo([]byte("go")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := call.Wait(ctx); err != nil || string(data) != "done" {
+		t.Errorf("%s expected, %s, %v got.", "done", data, err)
+	}
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+)
+
+// Submitter runs the jobs of typed functions, it is *Client or *Pool.
+type Submitter interface {
+	call(ctx context.Context, funcname string, data []byte,
+		flag byte) (*Call, error)
+}
+
+func (client *Client) call(ctx context.Context, funcname string,
+	data []byte, flag byte) (*Call, error) {
+	return client.Call(ctx, funcname, data, flag)
+}
+
+func (pool *Pool) call(ctx context.Context, funcname string,
+	data []byte, flag byte) (c *Call, err error) {
+	_, c, err = pool.Call(ctx, funcname, data, flag)
+	return
+}
+
+// Func is a typed handle of the function Name, which takes a Req and
+// returns a Res, both encoded by Codec.
+type Func[Req, Res any] struct {
+	Name  string
+	Codec Codec
+	// Flag can be set to: JobLow, JobNormal and JobHigh
+	Flag byte
+}
+
+// NewFunc returns the typed handle of the function name.
+func NewFunc[Req, Res any](name string, codec Codec) *Func[Req, Res] {
+	return &Func[Req, Res]{Name: name, Codec: codec}
+}
+
+// Call runs the function with req on s and decodes its result. A
+// *CodecError tells that req or the result couldn't be coded, other
+// errors are the ones of (*Call).Wait.
+func (f *Func[Req, Res]) Call(ctx context.Context, s Submitter,
+	req Req) (res Res, err error) {
+	var data []byte
+	if data, err = f.Codec.Marshal(req); err != nil {
+		err = &CodecError{Op: "marshal", Funcname: f.Name, Err: err}
+		return
+	}
+	var c *Call
+	if c, err = s.call(ctx, f.Name, data, f.Flag); err != nil {
+		return
+	}
+	if data, err = c.Wait(ctx); err != nil {
+		return
+	}
+	if err = f.Codec.Unmarshal(data, &res); err != nil {
+		err = &CodecError{Op: "unmarshal", Funcname: f.Name, Err: err}
+	}
+	return
+}
@@ -12,6 +12,9 @@ func main() {
 	// You can write your own id generator
 	// by implementing IdGenerator interface.
 	// client.IdGen = client.NewAutoIncId()
+	// IDs unique across hosts are made by client.NewUUIDv4Id,
+	// client.NewUUIDv7Id or client.NewULID, and given to a single
+	// client with client.WithIdGenerator.
 
 	c, err := client.New(client.Network, "127.0.0.1:4730")
 	if err != nil {
@@ -4,7 +4,7 @@
 
 /*
 This module is a Gearman API for the Go Programming Language.
-The protocols were written in pure Go. It contains two sub-packages:
+The protocols were written in pure Go. It contains four sub-packages:
 
 The client package is used for sending jobs to the Gearman job server,
 and getting responses from the server.
@@ -15,5 +15,15 @@ The worker package will help developers to develop Gearman's worker
 in an easy way.
 
 	import "github.com/mikespook/gearman-go/worker"
+
+The admin package talks to the administrative interface of the
+Gearman job server, as gearadmin does.
+
+	import "github.com/mikespook/gearman-go/admin"
+
+The protocol package encodes and decodes the binary packets shared
+by the others. Use it for proxies, test servers and so on.
+
+	import "github.com/mikespook/gearman-go/protocol"
 */
 package gearman
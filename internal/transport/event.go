@@ -0,0 +1,44 @@
+package transport
+
+// ConnState is a state of the connection to a job server.
+type ConnState int
+
+const (
+	StateConnecting ConnState = iota
+	StateConnected
+	StateDisconnected
+	StateReconnecting
+	StateClosed
+)
+
+var connStateNames = [...]string{
+	StateConnecting:   "connecting",
+	StateConnected:    "connected",
+	StateDisconnected: "disconnected",
+	StateReconnecting: "reconnecting",
+	StateClosed:       "closed",
+}
+
+func (s ConnState) String() string {
+	if s < 0 || int(s) >= len(connStateNames) {
+		return "unknown"
+	}
+	return connStateNames[s]
+}
+
+// ConnEvent tells that the connection to the job server at Addr
+// changed its state.
+type ConnEvent struct {
+	Addr  string
+	State ConnState
+	// Attempt counts the reconnecting attempts from 1,
+	// only for StateReconnecting.
+	Attempt int
+	// Err is why the connection was lost for StateDisconnected,
+	// or why the last attempt failed for StateReconnecting.
+	Err error
+}
+
+// ConnHandler is called with every ConnEvent, in order. It is called
+// from the connection's goroutines, so it must not block.
+type ConnHandler func(ConnEvent)
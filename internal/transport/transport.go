@@ -0,0 +1,97 @@
+// Package transport holds what the client and the worker share about
+// their connections to job servers.
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+// DialFunc connects to the job server at addr, eg.
+// (*net.Dialer).DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Dialer connects to job servers.
+type Dialer struct {
+	Dial           DialFunc    // (*net.Dialer).DialContext if nil
+	TLS            *tls.Config // handshaked over the dialed connection
+	ConnectTimeout time.Duration
+	// The deadlines of every read and write, see IsTimeout.
+	ReadTimeout, WriteTimeout time.Duration
+}
+
+// Connect dials the job server within the connect timeout,
+// handshaking TLS if configured.
+func (d *Dialer) Connect(network, addr string) (conn net.Conn, err error) {
+	ctx := context.Background()
+	if d.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.ConnectTimeout)
+		defer cancel()
+	}
+	dial := d.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	if conn, err = dial(ctx, network, addr); err != nil {
+		return
+	}
+	if d.TLS != nil {
+		config := d.TLS
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName = hostname(addr)
+		}
+		tlsConn := tls.Client(conn, config)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	if d.ReadTimeout > 0 || d.WriteTimeout > 0 {
+		conn = &timeoutConn{Conn: conn, read: d.ReadTimeout, write: d.WriteTimeout}
+	}
+	return
+}
+
+// IsTimeout tells if err is a deadline of a read or write. A read
+// timing out between two packets leaves the stream intact, within a
+// packet it doesn't.
+func IsTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// timeoutConn sets the deadline before every read and write, so
+// the connection is taken as lost when it is stuck for too long.
+type timeoutConn struct {
+	net.Conn
+	read, write time.Duration
+}
+
+func (c *timeoutConn) Read(b []byte) (int, error) {
+	if c.read > 0 {
+		c.SetReadDeadline(time.Now().Add(c.read))
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *timeoutConn) Write(b []byte) (int, error) {
+	if c.write > 0 {
+		c.SetWriteDeadline(time.Now().Add(c.write))
+	}
+	return c.Conn.Write(b)
+}
+
+// hostname returns the host of addr for verifying TLS certificates.
+func hostname(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,345 @@
+// The protocol package encodes and decodes the binary packets of the
+// Gearman protocol. It is shared by the client and worker packages,
+// and can be used to write proxies, test servers, dissectors, etc.
+//
+// A packet is a 12 bytes header followed by the arguments, separated
+// by NULL bytes:
+//
+//	\0REQ or \0RES | type (uint32) | size (uint32) | arg\0arg\0...data
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// Length of a packet header
+	HeaderSize = 12
+	// Default limit of the body size of a packet read by a Decoder
+	DefaultMaxSize = 64 << 20
+)
+
+var (
+	ErrIncomplete   = errors.New("Incomplete packet")
+	ErrInvalidMagic = errors.New("Invalid magic code")
+)
+
+// Magic code of a packet
+type Magic uint32
+
+const (
+	Req Magic = 0x00524551 // \0REQ
+	Res Magic = 0x00524553 // \0RES
+)
+
+func (m Magic) String() string {
+	switch m {
+	case Req:
+		return "REQ"
+	case Res:
+		return "RES"
+	}
+	return fmt.Sprintf("Magic(%#08x)", uint32(m))
+}
+
+// ArgsError is returned when the arguments of a packet don't match
+// its type.
+type ArgsError struct {
+	Type     PacketType
+	Expected int
+	Got      int
+}
+
+func (e *ArgsError) Error() string {
+	return fmt.Sprintf("%s: %d arguments expected, %d got",
+		e.Type, e.Expected, e.Got)
+}
+
+// SizeError is returned by a Decoder when the header of a packet
+// announces a body larger than its MaxSize.
+type SizeError struct {
+	Type PacketType
+	Size int
+	Max  int
+	// Handle is the first argument of the skipped packet, the job
+	// handle of the packets of a job. It is empty for the types of
+	// one argument.
+	Handle []byte
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("%s: packet of %d bytes exceeds the limit of %d",
+		e.Type, e.Size, e.Max)
+}
+
+// Packet is a decoded Gearman packet.
+type Packet struct {
+	Magic Magic
+	Type  PacketType
+	Args  [][]byte
+
+	buf    *[]byte // pooled body the arguments point to
+	header [HeaderSize]byte
+}
+
+// NewRequest returns a packet sent to the job server.
+func NewRequest(t PacketType, args ...[]byte) *Packet {
+	return &Packet{Magic: Req, Type: t, Args: args}
+}
+
+// NewResponse returns a packet sent by the job server.
+func NewResponse(t PacketType, args ...[]byte) *Packet {
+	return &Packet{Magic: Res, Type: t, Args: args}
+}
+
+// Arg returns the i-th argument, nil if there isn't one.
+func (p *Packet) Arg(i int) []byte {
+	if i < 0 || i >= len(p.Args) {
+		return nil
+	}
+	return p.Args[i]
+}
+
+// Body returns the arguments joined with NULL bytes, as they are
+// sent on the wire.
+func (p *Packet) Body() []byte {
+	if len(p.Args) == 1 {
+		return p.Args[0]
+	}
+	return bytes.Join(p.Args, []byte{'\x00'})
+}
+
+// Size returns the length of the encoded packet.
+func (p *Packet) Size() int {
+	l := HeaderSize
+	for i, arg := range p.Args {
+		if i > 0 {
+			l++
+		}
+		l += len(arg)
+	}
+	return l
+}
+
+// Validate checks the arguments against the packet type. Only the
+// last argument of a packet may contain NULL bytes. Packets of
+// unknown types are always valid.
+func (p *Packet) Validate() error {
+	n := p.Type.NumArgs()
+	if n < 0 {
+		return nil
+	}
+	if len(p.Args) != n {
+		return &ArgsError{Type: p.Type, Expected: n, Got: len(p.Args)}
+	}
+	for i := 0; i < n-1; i++ {
+		if bytes.IndexByte(p.Args[i], '\x00') != -1 {
+			return fmt.Errorf("%s: NULL byte in argument %d", p.Type, i)
+		}
+	}
+	return nil
+}
+
+// Encode a packet to byte slice.
+func (p *Packet) Encode() (data []byte, err error) {
+	if err = p.Validate(); err != nil {
+		return
+	}
+	data = make([]byte, p.Size())
+	p.encode(data)
+	return
+}
+
+// WriteTo writes the encoded packet to w. Unlike Encode, nothing is
+// allocated, so w should be buffered.
+func (p *Packet) WriteTo(w io.Writer) (n int64, err error) {
+	if err = p.Validate(); err != nil {
+		return
+	}
+	p.encodeHeader(p.header[:])
+	var l int
+	l, err = w.Write(p.header[:])
+	n += int64(l)
+	for k, arg := range p.Args {
+		if err != nil {
+			return
+		}
+		if k > 0 {
+			l, err = w.Write(nul)
+			n += int64(l)
+			if err != nil {
+				return
+			}
+		}
+		l, err = w.Write(arg)
+		n += int64(l)
+	}
+	return
+}
+
+var nul = []byte{'\x00'}
+
+func (p *Packet) encodeHeader(header []byte) {
+	binary.BigEndian.PutUint32(header[:4], uint32(p.Magic))
+	binary.BigEndian.PutUint32(header[4:8], uint32(p.Type))
+	binary.BigEndian.PutUint32(header[8:HeaderSize], uint32(p.Size()-HeaderSize))
+}
+
+func (p *Packet) encode(data []byte) {
+	p.encodeHeader(data)
+	i := HeaderSize
+	for k, arg := range p.Args {
+		if k > 0 {
+			data[i] = '\x00'
+			i++
+		}
+		i += copy(data[i:], arg)
+	}
+}
+
+// Decode a packet from the beginning of the byte slice, n is the
+// number of bytes used. ErrIncomplete is returned if data doesn't
+// hold a whole packet. The arguments share memory with data.
+//
+// If the arguments don't match the type, an *ArgsError is returned
+// along with the length of the bad packet.
+func Decode(data []byte) (p *Packet, n int, err error) {
+	if len(data) < HeaderSize {
+		return nil, 0, ErrIncomplete
+	}
+	var size int
+	p, size, err = decodeHeader(data[:HeaderSize])
+	if err != nil {
+		return nil, 0, err
+	}
+	n = HeaderSize + size
+	if len(data) < n {
+		return nil, 0, ErrIncomplete
+	}
+	if p.Args, err = splitArgs(p.Args, p.Type, data[HeaderSize:n]); err != nil {
+		// the packet is complete, the caller can skip n bytes
+		p.Release()
+		return nil, n, err
+	}
+	return
+}
+
+func decodeHeader(header []byte) (p *Packet, size int, err error) {
+	m := Magic(binary.BigEndian.Uint32(header[:4]))
+	if m != Req && m != Res {
+		return nil, 0, ErrInvalidMagic
+	}
+	p = GetPacket(m, PacketType(binary.BigEndian.Uint32(header[4:8])))
+	size = int(binary.BigEndian.Uint32(header[8:HeaderSize]))
+	return
+}
+
+// Split the body into the number of arguments of the type,
+// appending them to args.
+func splitArgs(args [][]byte, t PacketType, body []byte) ([][]byte, error) {
+	n := t.NumArgs()
+	switch {
+	case n < 0:
+		n = 1 // unknown type, keep the whole body
+	case n == 0:
+		if len(body) != 0 {
+			return args, &ArgsError{Type: t, Expected: 0, Got: 1}
+		}
+		return args, nil
+	}
+	for i := 0; i < n-1; i++ {
+		j := bytes.IndexByte(body, '\x00')
+		if j < 0 {
+			return args, &ArgsError{Type: t, Expected: n, Got: i + 1}
+		}
+		args = append(args, body[:j])
+		body = body[j+1:]
+	}
+	return append(args, body), nil
+}
+
+// Decoder reads packets from a stream.
+type Decoder struct {
+	// MaxSize bounds the body of a packet, so that a corrupt or hostile
+	// stream can't make the decoder allocate up to 4GB per packet.
+	// A larger packet is skipped and fails with a *SizeError.
+	MaxSize int
+
+	r      io.Reader
+	header [HeaderSize]byte
+}
+
+// NewDecoder returns a decoder reading from r, with a MaxSize of
+// DefaultMaxSize.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{MaxSize: DefaultMaxSize, r: r}
+}
+
+// Decode reads the next packet. io.EOF is returned only if the
+// stream ends between two packets. The body of a packet over MaxSize
+// is read and dropped, decoding goes on after the *SizeError.
+//
+// The packet body comes from a pool. Call Release on the packet once
+// the arguments are no longer used, or just drop it for the GC.
+func (d *Decoder) Decode() (p *Packet, err error) {
+	if _, err = io.ReadFull(d.r, d.header[:]); err != nil {
+		return
+	}
+	var size int
+	if p, size, err = decodeHeader(d.header[:]); err != nil {
+		return
+	}
+	if size > d.MaxSize {
+		e := &SizeError{Type: p.Type, Size: size, Max: d.MaxSize}
+		p.Release()
+		return nil, d.skip(e)
+	}
+	p.buf = getBuffer(size)
+	if _, err = io.ReadFull(d.r, *p.buf); err != nil {
+		p.Release()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if p.Args, err = splitArgs(p.Args, p.Type, *p.buf); err != nil {
+		p.Release()
+		return nil, err
+	}
+	return
+}
+
+// Most bytes of an oversized packet kept to find its handle
+const maxHandleSize = 256
+
+// skip reads the body of the oversized packet of e, keeping its first
+// argument. It returns e, or the error of the stream.
+func (d *Decoder) skip(e *SizeError) error {
+	n := e.Size
+	if n > maxHandleSize {
+		n = maxHandleSize
+	}
+	head := make([]byte, n)
+	if _, err := io.ReadFull(d.r, head); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if e.Type.NumArgs() > 1 {
+		if i := bytes.IndexByte(head, '\x00'); i >= 0 {
+			e.Handle = head[:i]
+		}
+	}
+	if _, err := io.CopyN(io.Discard, d.r, int64(e.Size-n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return e
+}
@@ -0,0 +1,313 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var (
+	// moved from the worker's outpack tests
+	reqcases = map[PacketType]struct {
+		args []string
+		src  string
+	}{
+		CanDo:          {[]string{"a"}, "\x00REQ\x00\x00\x00\x01\x00\x00\x00\x01a"},
+		CanDoTimeout:   {[]string{"a", "\x00\x00\x00\x01"}, "\x00REQ\x00\x00\x00\x17\x00\x00\x00\x06a\x00\x00\x00\x00\x01"},
+		CantDo:         {[]string{"a"}, "\x00REQ\x00\x00\x00\x02\x00\x00\x00\x01a"},
+		ResetAbilities: {nil, "\x00REQ\x00\x00\x00\x03\x00\x00\x00\x00"},
+		PreSleep:       {nil, "\x00REQ\x00\x00\x00\x04\x00\x00\x00\x00"},
+		GrabJob:        {nil, "\x00REQ\x00\x00\x00\x09\x00\x00\x00\x00"},
+		GrabJobUniq:    {nil, "\x00REQ\x00\x00\x00\x1E\x00\x00\x00\x00"},
+		GrabJobAll:     {nil, "\x00REQ\x00\x00\x00\x27\x00\x00\x00\x00"},
+		WorkData:       {[]string{"a", "b"}, "\x00REQ\x00\x00\x00\x1C\x00\x00\x00\x03a\x00b"},
+		WorkWarning:    {[]string{"a", "b"}, "\x00REQ\x00\x00\x00\x1D\x00\x00\x00\x03a\x00b"},
+		WorkStatus:     {[]string{"a", "50", "100"}, "\x00REQ\x00\x00\x00\x0C\x00\x00\x00\x08a\x0050\x00100"},
+		WorkComplete:   {[]string{"a", "b"}, "\x00REQ\x00\x00\x00\x0D\x00\x00\x00\x03a\x00b"},
+		WorkFail:       {[]string{"a"}, "\x00REQ\x00\x00\x00\x0E\x00\x00\x00\x01a"},
+		WorkException:  {[]string{"a", "b"}, "\x00REQ\x00\x00\x00\x19\x00\x00\x00\x03a\x00b"},
+		SetClientId:    {[]string{"a"}, "\x00REQ\x00\x00\x00\x16\x00\x00\x00\x01a"},
+		AllYours:       {nil, "\x00REQ\x00\x00\x00\x18\x00\x00\x00\x00"},
+		SubmitJob:      {[]string{"a", "b", "x\x00y"}, "\x00REQ\x00\x00\x00\x07\x00\x00\x00\x07a\x00b\x00x\x00y"},
+	}
+	rescases = map[PacketType]struct {
+		src  string
+		args []string
+	}{
+		Noop:          {"\x00RES\x00\x00\x00\x06\x00\x00\x00\x00", nil},
+		NoJob:         {"\x00RES\x00\x00\x00\x0a\x00\x00\x00\x00", nil},
+		JobAssign:     {"\x00RES\x00\x00\x00\x0b\x00\x00\x00\x07a\x00b\x00xyz", []string{"a", "b", "xyz"}},
+		JobAssignUniq: {"\x00RES\x00\x00\x00\x1F\x00\x00\x00\x09a\x00b\x00c\x00xyz", []string{"a", "b", "c", "xyz"}},
+		JobAssignAll:  {"\x00RES\x00\x00\x00\x28\x00\x00\x00\x0Ba\x00b\x00c\x00d\x00xyz", []string{"a", "b", "c", "d", "xyz"}},
+		EchoRes:       {"\x00RES\x00\x00\x00\x11\x00\x00\x00\x03a\x00b", []string{"a\x00b"}},
+		StatusRes:     {"\x00RES\x00\x00\x00\x14\x00\x00\x00\x09a\x001\x000\x001\x002", []string{"a", "1", "0", "1", "2"}},
+	}
+)
+
+func toArgs(s []string) (args [][]byte) {
+	for _, v := range s {
+		args = append(args, []byte(v))
+	}
+	return
+}
+
+func TestEncode(t *testing.T) {
+	for k, v := range reqcases {
+		data, err := NewRequest(k, toArgs(v.args)...).Encode()
+		if err != nil {
+			t.Errorf("%s: %s", k, err)
+			continue
+		}
+		if bytes.Compare([]byte(v.src), data) != 0 {
+			t.Errorf("%s: %X expected, %X got.", k, v.src, data)
+		}
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	if _, err := NewRequest(WorkComplete, []byte("a")).Encode(); err == nil {
+		t.Error("ArgsError expected")
+	} else if _, ok := err.(*ArgsError); !ok {
+		t.Errorf("ArgsError expected, %s got.", err)
+	}
+	if _, err := NewRequest(WorkComplete, []byte("a\x00"), nil).Encode(); err == nil {
+		t.Error("Error expected for NULL byte in the handle")
+	}
+	if _, err := NewRequest(PacketType(100), []byte("a\x00b")).Encode(); err != nil {
+		t.Errorf("Unknown types should pass, %s got.", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for k, v := range rescases {
+		p, n, err := Decode([]byte(v.src + "trailing"))
+		if err != nil {
+			t.Errorf("%s: %s", k, err)
+			continue
+		}
+		if n != len(v.src) {
+			t.Errorf("%s: length %d expected, %d got.", k, len(v.src), n)
+		}
+		if p.Magic != Res || p.Type != k {
+			t.Errorf("%s: %s %s got.", k, p.Magic, p.Type)
+		}
+		if !reflect.DeepEqual(toArgs(v.args), p.Args) {
+			t.Errorf("%s: %q expected, %q got.", k, v.args, p.Args)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	src := rescases[JobAssign].src
+	if _, _, err := Decode([]byte(src[:HeaderSize-1])); err != ErrIncomplete {
+		t.Errorf("ErrIncomplete expected, %v got.", err)
+	}
+	if _, _, err := Decode([]byte(src[:len(src)-1])); err != ErrIncomplete {
+		t.Errorf("ErrIncomplete expected, %v got.", err)
+	}
+	if _, _, err := Decode([]byte("\x00XYZ" + src[4:])); err != ErrInvalidMagic {
+		t.Errorf("ErrInvalidMagic expected, %v got.", err)
+	}
+	bad := "\x00RES\x00\x00\x00\x0b\x00\x00\x00\x03a\x00b"
+	_, n, err := Decode([]byte(bad))
+	if _, ok := err.(*ArgsError); !ok {
+		t.Errorf("ArgsError expected, %v got.", err)
+	}
+	if n != len(bad) {
+		t.Errorf("Length %d expected, %d got.", len(bad), n)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	var buf bytes.Buffer
+	for _, k := range []PacketType{Noop, JobAssign, StatusRes, NoJob} {
+		buf.WriteString(rescases[k].src)
+	}
+	d := NewDecoder(&buf)
+	for _, k := range []PacketType{Noop, JobAssign, StatusRes, NoJob} {
+		p, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Type != k {
+			t.Errorf("%s expected, %s got.", k, p.Type)
+		}
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Errorf("io.EOF expected, %v got.", err)
+	}
+	d = NewDecoder(bytes.NewBufferString(rescases[JobAssign].src[:15]))
+	if _, err := d.Decode(); err != io.ErrUnexpectedEOF {
+		t.Errorf("io.ErrUnexpectedEOF expected, %v got.", err)
+	}
+}
+
+func TestDecoderMaxSize(t *testing.T) {
+	src := rescases[JobAssign].src
+	d := NewDecoder(bytes.NewBufferString(src))
+	d.MaxSize = len(src) - HeaderSize - 1
+	_, err := d.Decode()
+	e, ok := err.(*SizeError)
+	if !ok {
+		t.Fatalf("*SizeError expected, %v got.", err)
+	}
+	if e.Type != JobAssign || e.Size != len(src)-HeaderSize || e.Max != d.MaxSize {
+		t.Errorf("Bad size error: %v", e)
+	}
+	if string(e.Handle) != "a" {
+		t.Errorf("%s expected, %s got.", "a", e.Handle)
+	}
+
+	// The packet is skipped, the next one is decoded.
+	large := "\x00RES\x00\x00\x00\x1c\x00\x00\x04\x01H:1\x00" + strings.Repeat("x", 1021)
+	d = NewDecoder(iotest.HalfReader(bytes.NewBufferString(large + rescases[Noop].src)))
+	d.MaxSize = 1024
+	if _, err = d.Decode(); err == nil {
+		t.Fatal("Error expected, nil got.")
+	} else if e, ok = err.(*SizeError); !ok {
+		t.Fatalf("*SizeError expected, %v got.", err)
+	} else if e.Type != WorkData || string(e.Handle) != "H:1" {
+		t.Errorf("Bad size error: %v %s", e, e.Handle)
+	}
+	if p, err := d.Decode(); err != nil || p.Type != Noop {
+		t.Errorf("%s expected, %v, %v got.", Noop, p, err)
+	}
+
+	// A header announcing 4GB allocates nothing, the body is missing.
+	d = NewDecoder(bytes.NewBufferString("\x00RES\x00\x00\x00\x0b\xff\xff\xff\xff"))
+	if _, err = d.Decode(); err != io.ErrUnexpectedEOF {
+		t.Errorf("%v expected, %v got.", io.ErrUnexpectedEOF, err)
+	}
+
+	d = NewDecoder(bytes.NewBufferString(src))
+	d.MaxSize = len(src) - HeaderSize
+	if _, err = d.Decode(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecoderFragmented(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), 1<<18) // 4MB
+	var buf bytes.Buffer
+	for i := 0; i < 3; i++ {
+		NewResponse(WorkData, []byte("H:1"), large).WriteTo(&buf)
+		NewResponse(Noop).WriteTo(&buf)
+	}
+	d := NewDecoder(iotest.HalfReader(iotest.DataErrReader(&buf)))
+	for i := 0; i < 3; i++ {
+		p, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Type != WorkData || bytes.Compare(large, p.Arg(1)) != 0 {
+			t.Fatalf("%s with %d bytes got.", p.Type, len(p.Arg(1)))
+		}
+		if p, err = d.Decode(); err != nil || p.Type != Noop {
+			t.Fatalf("NOOP expected, %v %v got.", p, err)
+		}
+	}
+	src := rescases[JobAssign].src
+	d = NewDecoder(iotest.OneByteReader(bytes.NewBufferString(src + src)))
+	for i := 0; i < 2; i++ {
+		if p, err := d.Decode(); err != nil || p.Type != JobAssign {
+			t.Fatalf("JOB_ASSIGN expected, %v %v got.", p, err)
+		}
+	}
+}
+
+func TestBufferClass(t *testing.T) {
+	for n, class := range map[int]int{0: 0, 64: 0, 65: 1, 256: 1,
+		4096: 3, 65536: 5, 65537: -1} {
+		if c := bufferClass(n); c != class {
+			t.Errorf("%d: class %d expected, %d got.", n, class, c)
+		}
+		buf := getBuffer(n)
+		if len(*buf) != n {
+			t.Errorf("%d: length %d got.", n, len(*buf))
+		}
+		putBuffer(buf)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	src := rescases[JobAssign].src
+	p, err := NewDecoder(bytes.NewBufferString(src)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := p.Args
+	p.Release()
+	if len(p.Args) != 0 || p.buf != nil {
+		t.Errorf("Released packet not reset: %v", p)
+	}
+	for i, arg := range args[:cap(args)] {
+		if arg != nil {
+			t.Errorf("Argument %d still referenced: %q", i, arg)
+		}
+	}
+}
+
+func benchmarkPackets() (packets []*Packet) {
+	for k, v := range reqcases {
+		packets = append(packets, NewRequest(k, toArgs(v.args)...))
+	}
+	return
+}
+
+func BenchmarkEncode(b *testing.B) {
+	packets := benchmarkPackets()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, p := range packets {
+			if _, err := p.Encode(); err != nil {
+				b.Error(err)
+			}
+		}
+	}
+}
+
+func BenchmarkWriteTo(b *testing.B) {
+	packets := benchmarkPackets()
+	w := bufio.NewWriter(ioutil.Discard)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, p := range packets {
+			p = GetPacket(Req, p.Type, p.Args...)
+			if _, err := p.WriteTo(w); err != nil {
+				b.Error(err)
+			}
+			p.Release()
+		}
+	}
+}
+
+func benchmarkDecoder(b *testing.B, release bool) {
+	src := []byte(rescases[JobAssign].src)
+	r := bytes.NewReader(src)
+	d := NewDecoder(r)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(src)
+		p, err := d.Decode()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if release {
+			p.Release()
+		}
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	benchmarkDecoder(b, true)
+}
+
+// Without Release every packet is allocated, for comparison
+func BenchmarkDecoderNoRelease(b *testing.B) {
+	benchmarkDecoder(b, false)
+}
@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"sync"
+)
+
+var (
+	packetPool = sync.Pool{
+		New: func() interface{} {
+			return &Packet{}
+		},
+	}
+
+	// Body buffers are pooled in size classes of 64 bytes to 64KB,
+	// larger bodies are allocated and left to the GC.
+	bufferPools [6]sync.Pool
+)
+
+const (
+	minBufferShift = 6
+	maxBufferShift = minBufferShift + 2*(len(bufferPools)-1)
+)
+
+// GetPacket returns a packet from the pool. Call Release when the
+// packet has been written.
+func GetPacket(m Magic, t PacketType, args ...[]byte) (p *Packet) {
+	p = packetPool.Get().(*Packet)
+	p.Magic = m
+	p.Type = t
+	p.Args = append(p.Args[:0], args...)
+	return
+}
+
+// Release puts the packet back to the pool. Neither the packet nor
+// any of its arguments may be used afterwards.
+func (p *Packet) Release() {
+	for i := range p.Args {
+		p.Args[i] = nil
+	}
+	p.Args = p.Args[:0]
+	if p.buf != nil {
+		putBuffer(p.buf)
+		p.buf = nil
+	}
+	packetPool.Put(p)
+}
+
+func bufferClass(n int) int {
+	for i := range bufferPools {
+		if n <= 1<<uint(minBufferShift+2*i) {
+			return i
+		}
+	}
+	return -1
+}
+
+func getBuffer(n int) *[]byte {
+	i := bufferClass(n)
+	if i < 0 {
+		buf := make([]byte, n)
+		return &buf
+	}
+	if v := bufferPools[i].Get(); v != nil {
+		buf := v.(*[]byte)
+		*buf = (*buf)[:n]
+		return buf
+	}
+	buf := make([]byte, n, 1<<uint(minBufferShift+2*i))
+	return &buf
+}
+
+func putBuffer(buf *[]byte) {
+	c := cap(*buf)
+	if c > 1<<maxBufferShift {
+		return
+	}
+	if i := bufferClass(c); i >= 0 && c == 1<<uint(minBufferShift+2*i) {
+		bufferPools[i].Put(buf)
+	}
+}
@@ -0,0 +1,118 @@
+package protocol
+
+import (
+	"fmt"
+)
+
+// Type of a packet
+type PacketType uint32
+
+const (
+	CanDo             PacketType = 1
+	CantDo            PacketType = 2
+	ResetAbilities    PacketType = 3
+	PreSleep          PacketType = 4
+	Noop              PacketType = 6
+	SubmitJob         PacketType = 7
+	JobCreated        PacketType = 8
+	GrabJob           PacketType = 9
+	NoJob             PacketType = 10
+	JobAssign         PacketType = 11
+	WorkStatus        PacketType = 12
+	WorkComplete      PacketType = 13
+	WorkFail          PacketType = 14
+	GetStatus         PacketType = 15
+	EchoReq           PacketType = 16
+	EchoRes           PacketType = 17
+	SubmitJobBg       PacketType = 18
+	Error             PacketType = 19
+	StatusRes         PacketType = 20
+	SubmitJobHigh     PacketType = 21
+	SetClientId       PacketType = 22
+	CanDoTimeout      PacketType = 23
+	AllYours          PacketType = 24
+	WorkException     PacketType = 25
+	OptionReq         PacketType = 26
+	OptionRes         PacketType = 27
+	WorkData          PacketType = 28
+	WorkWarning       PacketType = 29
+	GrabJobUniq       PacketType = 30
+	JobAssignUniq     PacketType = 31
+	SubmitJobHighBg   PacketType = 32
+	SubmitJobLow      PacketType = 33
+	SubmitJobLowBg    PacketType = 34
+	SubmitJobSched    PacketType = 35
+	SubmitJobEpoch    PacketType = 36
+	SubmitReduceJob   PacketType = 37
+	SubmitReduceJobBg PacketType = 38
+	GrabJobAll        PacketType = 39
+	JobAssignAll      PacketType = 40
+	GetStatusUnique   PacketType = 41
+	StatusResUnique   PacketType = 42
+)
+
+type typeInfo struct {
+	name string
+	args int
+}
+
+var types = map[PacketType]typeInfo{
+	CanDo:             {"CAN_DO", 1},
+	CantDo:            {"CANT_DO", 1},
+	ResetAbilities:    {"RESET_ABILITIES", 0},
+	PreSleep:          {"PRE_SLEEP", 0},
+	Noop:              {"NOOP", 0},
+	SubmitJob:         {"SUBMIT_JOB", 3},
+	JobCreated:        {"JOB_CREATED", 1},
+	GrabJob:           {"GRAB_JOB", 0},
+	NoJob:             {"NO_JOB", 0},
+	JobAssign:         {"JOB_ASSIGN", 3},
+	WorkStatus:        {"WORK_STATUS", 3},
+	WorkComplete:      {"WORK_COMPLETE", 2},
+	WorkFail:          {"WORK_FAIL", 1},
+	GetStatus:         {"GET_STATUS", 1},
+	EchoReq:           {"ECHO_REQ", 1},
+	EchoRes:           {"ECHO_RES", 1},
+	SubmitJobBg:       {"SUBMIT_JOB_BG", 3},
+	Error:             {"ERROR", 2},
+	StatusRes:         {"STATUS_RES", 5},
+	SubmitJobHigh:     {"SUBMIT_JOB_HIGH", 3},
+	SetClientId:       {"SET_CLIENT_ID", 1},
+	CanDoTimeout:      {"CAN_DO_TIMEOUT", 2},
+	AllYours:          {"ALL_YOURS", 0},
+	WorkException:     {"WORK_EXCEPTION", 2},
+	OptionReq:         {"OPTION_REQ", 1},
+	OptionRes:         {"OPTION_RES", 1},
+	WorkData:          {"WORK_DATA", 2},
+	WorkWarning:       {"WORK_WARNING", 2},
+	GrabJobUniq:       {"GRAB_JOB_UNIQ", 0},
+	JobAssignUniq:     {"JOB_ASSIGN_UNIQ", 4},
+	SubmitJobHighBg:   {"SUBMIT_JOB_HIGH_BG", 3},
+	SubmitJobLow:      {"SUBMIT_JOB_LOW", 3},
+	SubmitJobLowBg:    {"SUBMIT_JOB_LOW_BG", 3},
+	SubmitJobSched:    {"SUBMIT_JOB_SCHED", 8},
+	SubmitJobEpoch:    {"SUBMIT_JOB_EPOCH", 4},
+	SubmitReduceJob:   {"SUBMIT_REDUCE_JOB", 5},
+	SubmitReduceJobBg: {"SUBMIT_REDUCE_JOB_BACKGROUND", 5},
+	GrabJobAll:        {"GRAB_JOB_ALL", 0},
+	JobAssignAll:      {"JOB_ASSIGN_ALL", 5},
+	GetStatusUnique:   {"GET_STATUS_UNIQUE", 1},
+	StatusResUnique:   {"STATUS_RES_UNIQUE", 6},
+}
+
+// String returns the name used in the protocol document.
+func (t PacketType) String() string {
+	if info, ok := types[t]; ok {
+		return info.name
+	}
+	return fmt.Sprintf("PacketType(%d)", uint32(t))
+}
+
+// NumArgs returns the number of NULL separated arguments of packets
+// of the type, or -1 if the type is unknown.
+func (t PacketType) NumArgs() int {
+	if info, ok := types[t]; ok {
+		return info.args
+	}
+	return -1
+}
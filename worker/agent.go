@@ -2,11 +2,13 @@ package worker
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/binary"
+	"crypto/tls"
 	"io"
 	"net"
 	"sync"
+
+	"github.com/mikespook/gearman-go/internal/transport"
+	"github.com/mikespook/gearman-go/protocol"
 )
 
 // The agent of job server.
@@ -17,6 +19,9 @@ type agent struct {
 	worker    *Worker
 	in        chan []byte
 	net, addr string
+	allYours  bool
+	tlsConfig *tls.Config
+	attempts  int // reconnecting attempts since connected
 }
 
 // Create the agent of job server.
@@ -31,15 +36,60 @@ func newAgent(net, addr string, worker *Worker) (a *agent, err error) {
 }
 
 func (a *agent) Connect() (err error) {
+	if err = a.connect(); err != nil {
+		return
+	}
+	go a.work()
+	return
+}
+
+// connect dials the job server and greets it.
+func (a *agent) connect() (err error) {
+	a.event(StateConnecting, 0, nil)
 	a.Lock()
-	defer a.Unlock()
-	a.conn, err = net.Dial(a.net, a.addr)
+	a.conn, err = a.dial()
 	if err != nil {
+		a.Unlock()
 		return
 	}
-	a.rw = bufio.NewReadWriter(bufio.NewReader(a.conn),
-		bufio.NewWriter(a.conn))
-	go a.work()
+	a.rw = bufio.NewReadWriter(bufio.NewReaderSize(a.conn, a.worker.readBufferSize),
+		bufio.NewWriterSize(a.conn, a.worker.writeBufferSize))
+	if err = a.greet(); err != nil {
+		a.conn.Close()
+		a.conn = nil
+		a.Unlock()
+		return
+	}
+	a.attempts = 0
+	a.Unlock()
+	a.event(StateConnected, 0, nil)
+	return
+}
+
+// dial connects to the job server.
+func (a *agent) dial() (net.Conn, error) {
+	w := a.worker
+	d := transport.Dialer{
+		Dial:           w.dialer,
+		TLS:            a.tlsConfig,
+		ConnectTimeout: w.connectTimeout,
+		ReadTimeout:    w.readTimeout,
+		WriteTimeout:   w.writeTimeout,
+	}
+	return d.Connect(a.net, a.addr)
+}
+
+// greet sends what the job server needs to know about this
+// connection before any function is registered.
+func (a *agent) greet() (err error) {
+	if id := a.worker.Id; id != "" {
+		if err = a.write(getOutPack(protocol.SetClientId, []byte(id))); err != nil {
+			return
+		}
+	}
+	if a.allYours {
+		err = a.write(getOutPack(protocol.AllYours))
+	}
 	return
 }
 
@@ -50,12 +100,47 @@ func (a *agent) work() {
 		}
 	}()
 
-	var inpack *inPack
-	var l int
+	var p *protocol.Packet
 	var err error
-	var data, leftdata []byte
+	// A packet is read as a header and a body of the length given in
+	// the header, however the stream is fragmented.
+	rw := a.rw
+	dec := protocol.NewDecoder(rw)
+	dec.MaxSize = a.worker.maxPacketSize
+	pinged := false
 	for {
-		if data, err = a.read(); err != nil {
+		// The read timeout between two packets is idle time, a
+		// sleeping worker hears nothing until a job comes. It is
+		// checked with an ECHO_REQ.
+		if _, err = rw.Peek(1); transport.IsTimeout(err) && !pinged {
+			if err = a.Write(getOutPack(protocol.EchoReq, nil)); err == nil {
+				pinged = true
+				continue
+			}
+		}
+		if err == nil {
+			p, err = dec.Decode()
+		}
+		if err != nil {
+			if _, ok := err.(*protocol.ArgsError); ok {
+				// The whole packet was read, just skip it.
+				a.worker.err(err)
+				continue
+			}
+			if e, ok := err.(*protocol.SizeError); ok {
+				// The packet was skipped. A job too large is failed,
+				// or the job server would assign it again and again.
+				a.worker.err(err)
+				a.tooLarge(e)
+				continue
+			}
+			if transport.IsTimeout(err) {
+				// The ECHO_REQ is not answered, or a packet is
+				// stuck halfway.
+				a.worker.err(err)
+				a.redial(err)
+				return
+			}
 			if opErr, ok := err.(*net.OpError); ok {
 				if opErr.Temporary() {
 					continue
@@ -66,7 +151,7 @@ func (a *agent) work() {
 					break
 				}
 
-			} else if err == io.EOF {
+			} else if err == io.EOF || err == io.ErrUnexpectedEOF {
 				a.disconnect_error(err)
 				break
 			}
@@ -74,62 +159,80 @@ func (a *agent) work() {
 			// If it is unexpected error and the connection wasn't
 			// closed by Gearmand, the agent should close the conection
 			// and reconnect to job server.
-			a.Close()
-			a.conn, err = net.Dial(a.net, a.addr)
-			if err != nil {
-				a.worker.err(err)
-				break
-			}
-			a.rw = bufio.NewReadWriter(bufio.NewReader(a.conn),
-				bufio.NewWriter(a.conn))
+			a.redial(err)
+			return
 		}
-		if len(leftdata) > 0 { // some data left for processing
-			data = append(leftdata, data...)
-		}
-		if len(data) < minPacketLength { // not enough data
-			leftdata = data
+		if pinged && p.Type == protocol.EchoRes {
+			// the answer of the keepalive
+			pinged = false
+			p.Release()
 			continue
 		}
-		for {
-			if inpack, l, err = decodeInPack(data); err != nil {
-				a.worker.err(err)
-				leftdata = data
-				break
-			} else {
-				leftdata = nil
-				inpack.a = a
-				a.worker.in <- inpack
-				if len(data) == l {
-					break
-				}
-				if len(data) > l {
-					data = data[l:]
-				}
-			}
+		pinged = false
+		inpack := newInPack(p)
+		inpack.a = a
+		a.worker.in <- inpack
+	}
+}
+
+// tooLarge fails the job assigned by a packet over the size limit,
+// and grabs the next one.
+func (a *agent) tooLarge(e *protocol.SizeError) {
+	switch e.Type {
+	case protocol.JobAssign, protocol.JobAssignUniq, protocol.JobAssignAll:
+		if len(e.Handle) > 0 {
+			a.Write(getOutPack(protocol.WorkFail, e.Handle))
 		}
+		a.Grab()
+	}
+}
+
+// redial replaces the broken connection, the work goes on in a new
+// goroutine. If the job server can't be reached, the ErrorHandler
+// gets a *WorkerDisconnectError to reconnect later, as when the job
+// server closes the connection.
+func (a *agent) redial(err error) {
+	a.close()
+	a.event(StateDisconnected, 0, err)
+	if err = a.reconnect(); err != nil {
+		a.event(StateDisconnected, 0, err)
+		a.worker.err(&WorkerDisconnectError{
+			err:   err,
+			agent: a,
+		})
 	}
 }
 
 func (a *agent) disconnect_error(err error) {
 	a.Lock()
-	defer a.Unlock()
+	connected := a.conn != nil
+	a.Unlock()
 
-	if a.conn != nil {
-		err = &WorkerDisconnectError{
+	if connected {
+		a.event(StateDisconnected, 0, err)
+		a.worker.err(&WorkerDisconnectError{
 			err:   err,
 			agent: a,
-		}
-		a.worker.err(err)
+		})
 	}
 }
 
 func (a *agent) Close() {
+	if a.close() {
+		a.event(StateClosed, 0, nil)
+	}
+}
+
+// close the connection, it is false if there was none.
+func (a *agent) close() bool {
 	a.Lock()
 	defer a.Unlock()
-	if a.conn != nil {
-		a.conn.Close()
-		a.conn = nil
+	if a.conn == nil {
+		return false
 	}
+	a.conn.Close()
+	a.conn = nil
+	return true
 }
 
 func (a *agent) Grab() {
@@ -139,80 +242,49 @@ func (a *agent) Grab() {
 }
 
 func (a *agent) grab() {
-	outpack := getOutPack()
-	outpack.dataType = dtGrabJobUniq
-	a.write(outpack)
+	if a.worker.GrabAll {
+		a.write(getOutPack(protocol.GrabJobAll))
+	} else {
+		a.write(getOutPack(protocol.GrabJobUniq))
+	}
 }
 
 func (a *agent) PreSleep() {
 	a.Lock()
 	defer a.Unlock()
-	outpack := getOutPack()
-	outpack.dataType = dtPreSleep
-	a.write(outpack)
+	a.write(getOutPack(protocol.PreSleep))
 }
 
 func (a *agent) reconnect() error {
 	a.Lock()
-	defer a.Unlock()
-	conn, err := net.Dial(a.net, a.addr)
-	if err != nil {
+	a.attempts++
+	attempt := a.attempts
+	a.Unlock()
+	a.event(StateReconnecting, attempt, nil)
+	if err := a.connect(); err != nil {
 		return err
 	}
-	a.conn = conn
-	a.rw = bufio.NewReadWriter(bufio.NewReader(a.conn),
-		bufio.NewWriter(a.conn))
 
+	a.Lock()
 	a.worker.reRegisterFuncsForAgent(a)
 	a.grab()
+	a.Unlock()
 
 	go a.work()
 	return nil
 }
 
-// read length bytes from the socket
-func (a *agent) read() (data []byte, err error) {
-	n := 0
-
-	tmp := getBuffer(bufferSize)
-	var buf bytes.Buffer
-
-	// read the header so we can get the length of the data
-	if n, err = a.rw.Read(tmp); err != nil {
+// Internal write the encoded job, the outpack goes back to the pool.
+func (a *agent) write(outpack *protocol.Packet) (err error) {
+	defer outpack.Release()
+	if _, err = outpack.WriteTo(a.rw); err != nil {
 		return
 	}
-	dl := int(binary.BigEndian.Uint32(tmp[8:12]))
-
-	// write what we read so far
-	buf.Write(tmp[:n])
-
-	// read until we receive all the data
-	for buf.Len() < dl+minPacketLength {
-		if n, err = a.rw.Read(tmp); err != nil {
-			return buf.Bytes(), err
-		}
-
-		buf.Write(tmp[:n])
-	}
-
-	return buf.Bytes(), err
-}
-
-// Internal write the encoded job.
-func (a *agent) write(outpack *outPack) (err error) {
-	var n int
-	buf := outpack.Encode()
-	for i := 0; i < len(buf); i += n {
-		n, err = a.rw.Write(buf[i:])
-		if err != nil {
-			return err
-		}
-	}
 	return a.rw.Flush()
 }
 
 // Write with lock
-func (a *agent) Write(outpack *outPack) (err error) {
+func (a *agent) Write(outpack *protocol.Packet) (err error) {
 	a.Lock()
 	defer a.Unlock()
 	return a.write(outpack)
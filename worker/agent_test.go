@@ -0,0 +1,446 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+func TestAgentAllYours(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	got := make(chan []byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+			close(got)
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, protocol.HeaderSize)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Error(err)
+		}
+		got <- buf
+	}()
+
+	w := New(Unlimited)
+	if err := w.AddServer(Network, l.Addr().String(), WithAllYours()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.agents[0].Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.agents[0].Close()
+	expected := []byte("\x00REQ\x00\x00\x00\x18\x00\x00\x00\x00")
+	if data := <-got; bytes.Compare(expected, data) != 0 {
+		t.Errorf("%X expected, %X got.", expected, data)
+	}
+}
+
+func TestAgentReadFragmented(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef"), 1<<18) // 4MB
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		dec := protocol.NewDecoder(bufio.NewReader(conn))
+		req, err := dec.Decode()
+		if err != nil {
+			return
+		}
+		var data []byte
+		for _, p := range []*protocol.Packet{
+			protocol.NewResponse(protocol.JobAssign, []byte("H:1"),
+				[]byte("foobar"), req.Arg(0)),
+			protocol.NewResponse(protocol.Noop),
+			protocol.NewResponse(protocol.EchoRes, req.Arg(0)),
+		} {
+			buf, _ := p.Encode()
+			data = append(data, buf...)
+		}
+		for i := 0; i < len(data); i += 5 {
+			j := i + 5
+			if j > len(data) {
+				j = len(data)
+			}
+			conn.Write(data[i:j])
+		}
+		dec.Decode() // wait for the client to close
+	}()
+
+	w := New(Unlimited)
+	w.ErrorHandler = func(e error) {
+		t.Error(e)
+	}
+	if err := w.AddServer(Network, l.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	a := w.agents[0]
+	if err := a.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.Write(getOutPack(protocol.EchoReq, large))
+	for _, dt := range []protocol.PacketType{protocol.JobAssign,
+		protocol.Noop, protocol.EchoRes} {
+		inpack := <-w.in
+		if inpack.dataType != dt {
+			t.Fatalf("%s expected, %s got.", dt, inpack.dataType)
+		}
+		if dt != protocol.Noop && bytes.Compare(large, inpack.data) != 0 {
+			t.Errorf("%s: %d bytes expected, %d got.", dt, len(large),
+				len(inpack.data))
+		}
+	}
+}
+
+func TestAgentConnEvents(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		// drop the first connection, keep the second
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.Close()
+		if conn, err = l.Accept(); err != nil {
+			return
+		}
+		io.Copy(io.Discard, conn)
+	}()
+
+	events := make(chan ConnEvent, 16)
+	w := New(Unlimited)
+	w.ConnHandler = func(e ConnEvent) {
+		events <- e
+	}
+	w.ErrorHandler = func(e error) {
+		if de, ok := e.(*WorkerDisconnectError); ok {
+			go de.Reconnect()
+		}
+	}
+	addr := l.Addr().String()
+	if err := w.AddServer(Network, addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.agents[0].Connect(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []ConnEvent{
+		{Addr: addr, State: StateConnecting},
+		{Addr: addr, State: StateConnected},
+		{Addr: addr, State: StateDisconnected, Err: io.EOF},
+		{Addr: addr, State: StateReconnecting, Attempt: 1},
+		{Addr: addr, State: StateConnecting},
+		{Addr: addr, State: StateConnected},
+		{Addr: addr, State: StateClosed},
+	}
+	for i, e := range expected {
+		if e.State == StateClosed {
+			w.agents[0].Close()
+		}
+		if got := <-events; got != e {
+			t.Errorf("%d: %+v expected, %+v got.", i, e, got)
+		}
+	}
+}
+
+func TestAgentReadTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// The first connection answers two ECHO_REQ, then goes silent.
+	echoes := make(chan int, 16)
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(n int, conn net.Conn) {
+				defer conn.Close()
+				dec := protocol.NewDecoder(conn)
+				for i := 0; ; i++ {
+					p, err := dec.Decode()
+					if err != nil {
+						return
+					}
+					if p.Type != protocol.EchoReq {
+						continue
+					}
+					echoes <- n
+					if n == 0 && i >= 2 {
+						continue
+					}
+					if _, err = protocol.NewResponse(protocol.EchoRes, p.Arg(0)).WriteTo(conn); err != nil {
+						return
+					}
+				}
+			}(n, conn)
+		}
+	}()
+
+	events := make(chan ConnEvent, 16)
+	w := New(Unlimited, WithReadTimeout(20*time.Millisecond))
+	w.ConnHandler = func(e ConnEvent) {
+		events <- e
+	}
+	if err := w.AddServer(Network, l.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.agents[0].Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.agents[0].Close()
+	// kept alive, then reconnected without the ErrorHandler
+	for _, expected := range []int{0, 0, 0, 1} {
+		select {
+		case n := <-echoes:
+			if n != expected {
+				t.Errorf("ECHO_REQ on connection %d expected, %d got.", expected, n)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("ECHO_REQ on connection %d expected.", expected)
+		}
+	}
+	var states []ConnState
+	for len(events) > 0 {
+		states = append(states, (<-events).State)
+	}
+	expected := []ConnState{StateConnecting, StateConnected, StateDisconnected,
+		StateReconnecting, StateConnecting, StateConnected}
+	if len(states) != len(expected) {
+		t.Fatalf("%v expected, %v got.", expected, states)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Errorf("%v expected, %v got.", expected, states)
+		}
+	}
+}
+
+func TestAgentTLS(t *testing.T) {
+	serverConfig, clientConfig := testTLSConfigs(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	got := make(chan []byte, 2)
+	go func() {
+		// read ALL_YOURS from both connections, drop the first
+		for i := 0; i < 2; i++ {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, protocol.HeaderSize)
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				t.Error(err)
+			}
+			got <- buf
+			if i == 0 {
+				conn.Close()
+			} else {
+				io.Copy(io.Discard, conn)
+			}
+		}
+	}()
+
+	w := New(Unlimited)
+	w.ErrorHandler = func(e error) {
+		if de, ok := e.(*WorkerDisconnectError); ok {
+			go de.Reconnect()
+		}
+	}
+	if err := w.AddServer(Network, l.Addr().String(), WithTLS(clientConfig),
+		WithAllYours()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.agents[0].Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.agents[0].Close()
+	expected := []byte("\x00REQ\x00\x00\x00\x18\x00\x00\x00\x00")
+	for i := 0; i < 2; i++ {
+		if data := <-got; bytes.Compare(expected, data) != 0 {
+			t.Errorf("%d: %X expected, %X got.", i, expected, data)
+		}
+	}
+	w.agents[0].Lock()
+	defer w.agents[0].Unlock()
+	if _, ok := w.agents[0].conn.(*tls.Conn); !ok {
+		t.Errorf("*tls.Conn expected, %T got.", w.agents[0].conn)
+	}
+}
+
+// Configs of a server and a client trusting each other by a
+// self-signed certificate for 127.0.0.1.
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gearman-go test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	server = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	client = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}
+	return
+}
+
+func TestAgentMaxPacketSize(t *testing.T) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	errs := make(chan error, 4)
+	w := New(Unlimited, WithMaxPacketSize(1024),
+		WithErrorHandler(func(e error) { errs <- e }),
+		WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return conn, nil
+		}))
+	if err := w.AddServer(Network, "in-memory"); err != nil {
+		t.Fatal(err)
+	}
+	a := w.agents[0]
+	if err := a.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	go protocol.NewResponse(protocol.JobAssign, []byte("H:1"), []byte("fn"),
+		make([]byte, 2048)).WriteTo(server)
+
+	// The poison job is failed, not assigned again after a reconnection.
+	dec := protocol.NewDecoder(server)
+	for _, expected := range []protocol.PacketType{protocol.WorkFail, protocol.GrabJobUniq} {
+		p, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Type != expected {
+			t.Errorf("%s expected, %s got.", expected, p.Type)
+		}
+		if expected == protocol.WorkFail && string(p.Arg(0)) != "H:1" {
+			t.Errorf("%s expected, %s got.", "H:1", p.Arg(0))
+		}
+	}
+	if err := <-errs; err == nil {
+		t.Error("Error expected, nil got.")
+	} else if _, ok := err.(*protocol.SizeError); !ok {
+		t.Errorf("*protocol.SizeError expected, %v got.", err)
+	}
+}
+
+func TestAgentRedialFailed(t *testing.T) {
+	// The first connection goes silent, the job server is down for
+	// the next dial.
+	var dials int
+	errDown := errors.New("down")
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if dials++; dials == 2 {
+			return nil, errDown
+		}
+		server, conn := net.Pipe()
+		go io.Copy(io.Discard, server)
+		return conn, nil
+	}
+	events := make(chan ConnEvent, 16)
+	disconnected := make(chan *WorkerDisconnectError, 16)
+	w := New(Unlimited, WithDialer(dial), WithReadTimeout(20*time.Millisecond))
+	w.ConnHandler = func(e ConnEvent) {
+		select {
+		case events <- e:
+		default: // the later connections go silent too
+		}
+	}
+	w.ErrorHandler = func(e error) {
+		if de, ok := e.(*WorkerDisconnectError); ok {
+			disconnected <- de
+		}
+	}
+	if err := w.AddServer(Network, "in-memory"); err != nil {
+		t.Fatal(err)
+	}
+	a := w.agents[0]
+	if err := a.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	var de *WorkerDisconnectError
+	select {
+	case de = <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("*WorkerDisconnectError expected.")
+	}
+	if de.err != errDown {
+		t.Errorf("%v expected, %v got.", errDown, de.err)
+	}
+	if err := de.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []ConnState{StateConnecting, StateConnected, StateDisconnected,
+		StateReconnecting, StateConnecting, StateDisconnected,
+		StateReconnecting, StateConnecting, StateConnected}
+	for i, state := range expected {
+		if got := <-events; got.State != state {
+			t.Errorf("%d: %v expected, %v got.", i, state, got.State)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package worker
+
+import "github.com/mikespook/gearman-go/internal/transport"
+
+// ConnState is a state of the connection to a job server.
+type ConnState = transport.ConnState
+
+const (
+	StateConnecting   = transport.StateConnecting
+	StateConnected    = transport.StateConnected
+	StateDisconnected = transport.StateDisconnected
+	StateReconnecting = transport.StateReconnecting
+	StateClosed       = transport.StateClosed
+)
+
+// ConnEvent tells that the connection to the job server at Addr
+// changed its state.
+type ConnEvent = transport.ConnEvent
+
+// ConnHandler is called with every ConnEvent, in order, from the
+// agents' goroutines, so it must not block. The same handler can be
+// given to clients and workers.
+type ConnHandler = transport.ConnHandler
+
+func (a *agent) event(state ConnState, attempt int, err error) {
+	if a.worker.ConnHandler != nil {
+		a.worker.ConnHandler(ConnEvent{Addr: a.addr, State: state,
+			Attempt: attempt, Err: err})
+	}
+}
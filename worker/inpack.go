@@ -1,23 +1,42 @@
 package worker
 
 import (
-	"bytes"
-	"encoding/binary"
-	"fmt"
+	"bufio"
+	"io"
 	"strconv"
+	"sync"
+
+	"github.com/mikespook/gearman-go/protocol"
 )
 
 // Worker side job
 type inPack struct {
-	dataType             uint32
-	data                 []byte
-	handle, uniqueId, fn string
-	a                    *agent
+	dataType                      protocol.PacketType
+	data                          []byte
+	handle, uniqueId, fn, reducer string
+	a                             *agent
+	p                             *protocol.Packet
+	w                             *bufio.Writer
+}
+
+var inPackPool = sync.Pool{
+	New: func() interface{} {
+		return &inPack{}
+	},
 }
 
 // Create a new job
 func getInPack() *inPack {
-	return &inPack{}
+	return inPackPool.Get().(*inPack)
+}
+
+// Put the job and its packet back to the pools
+func (inpack *inPack) release() {
+	if inpack.p != nil {
+		inpack.p.Release()
+	}
+	*inpack = inPack{}
+	inPackPool.Put(inpack)
 }
 
 func (inpack *inPack) Data() []byte {
@@ -36,8 +55,12 @@ func (inpack *inPack) UniqueId() string {
 	return inpack.uniqueId
 }
 
+func (inpack *inPack) Reducer() string {
+	return inpack.reducer
+}
+
 func (inpack *inPack) Err() error {
-	if inpack.dataType == dtError {
+	if inpack.dataType == protocol.Error {
 		return getError(inpack.data)
 	}
 	return nil
@@ -46,25 +69,60 @@ func (inpack *inPack) Err() error {
 // Send some datas to client.
 // Using this in a job's executing.
 func (inpack *inPack) SendData(data []byte) {
-	outpack := getOutPack()
-	outpack.dataType = dtWorkData
-	hl := len(inpack.handle)
-	l := hl + len(data) + 1
-	outpack.data = getBuffer(l)
-	copy(outpack.data, []byte(inpack.handle))
-	copy(outpack.data[hl+1:], data)
-	inpack.a.write(outpack)
+	outpack := getOutPack(protocol.WorkData, []byte(inpack.handle), data)
+	inpack.send(outpack)
 }
 
 func (inpack *inPack) SendWarning(data []byte) {
-	outpack := getOutPack()
-	outpack.dataType = dtWorkWarning
-	hl := len(inpack.handle)
-	l := hl + len(data) + 1
-	outpack.data = getBuffer(l)
-	copy(outpack.data, []byte(inpack.handle))
-	copy(outpack.data[hl+1:], data)
-	inpack.a.write(outpack)
+	outpack := getOutPack(protocol.WorkWarning, []byte(inpack.handle), data)
+	inpack.send(outpack)
+}
+
+// send writes outpack after what is buffered in the Writer, keeping
+// the output of the job in the order it was given.
+func (inpack *inPack) send(outpack *protocol.Packet) {
+	if err := inpack.flush(); err != nil {
+		outpack.Release()
+		return
+	}
+	inpack.a.Write(outpack)
+}
+
+func (inpack *inPack) Writer() io.Writer {
+	if inpack.w == nil {
+		inpack.w = bufio.NewWriterSize(dataWriter{inpack}, ChunkSize)
+	}
+	return inpack.w
+}
+
+// flush sends what is left in the Writer.
+func (inpack *inPack) flush() error {
+	if inpack.w == nil {
+		return nil
+	}
+	return inpack.w.Flush()
+}
+
+// dataWriter sends everything written as WORK_DATA.
+type dataWriter struct {
+	inpack *inPack
+}
+
+func (w dataWriter) Write(p []byte) (n int, err error) {
+	// bufio writes big slices straight through, split them too
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > ChunkSize {
+			chunk = chunk[:ChunkSize]
+		}
+		outpack := getOutPack(protocol.WorkData, []byte(w.inpack.handle), chunk)
+		if err = w.inpack.a.Write(outpack); err != nil {
+			return
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return
 }
 
 // Update status.
@@ -72,55 +130,43 @@ func (inpack *inPack) SendWarning(data []byte) {
 func (inpack *inPack) UpdateStatus(numerator, denominator int) {
 	n := []byte(strconv.Itoa(numerator))
 	d := []byte(strconv.Itoa(denominator))
-	outpack := getOutPack()
-	outpack.dataType = dtWorkStatus
-	hl := len(inpack.handle)
-	nl := len(n)
-	dl := len(d)
-	outpack.data = getBuffer(hl + nl + dl + 2)
-	copy(outpack.data, []byte(inpack.handle))
-	copy(outpack.data[hl+1:], n)
-	copy(outpack.data[hl+nl+2:], d)
-	inpack.a.write(outpack)
+	outpack := getOutPack(protocol.WorkStatus, []byte(inpack.handle), n, d)
+	inpack.send(outpack)
 }
 
 // Decode job from byte slice
 func decodeInPack(data []byte) (inpack *inPack, l int, err error) {
-	if len(data) < minPacketLength { // valid package should not less 12 bytes
-		err = fmt.Errorf("Invalid data: %v", data)
-		return
-	}
-	dl := int(binary.BigEndian.Uint32(data[8:12]))
-	if len(data) < (dl + minPacketLength) {
-		err = fmt.Errorf("Not enough data: %v", data)
-		return
-	}
-	dt := data[minPacketLength : dl+minPacketLength]
-	if len(dt) != int(dl) { // length not equal
-		err = fmt.Errorf("Invalid data: %v", data)
+	var p *protocol.Packet
+	if p, l, err = protocol.Decode(data); err != nil {
 		return
 	}
+	inpack = newInPack(p)
+	return
+}
+
+// Convert a decoded packet to job, the job owns the packet
+func newInPack(p *protocol.Packet) (inpack *inPack) {
 	inpack = getInPack()
-	inpack.dataType = binary.BigEndian.Uint32(data[4:8])
-	switch inpack.dataType {
-	case dtJobAssign:
-		s := bytes.SplitN(dt, []byte{'\x00'}, 3)
-		if len(s) == 3 {
-			inpack.handle = string(s[0])
-			inpack.fn = string(s[1])
-			inpack.data = s[2]
-		}
-	case dtJobAssignUniq:
-		s := bytes.SplitN(dt, []byte{'\x00'}, 4)
-		if len(s) == 4 {
-			inpack.handle = string(s[0])
-			inpack.fn = string(s[1])
-			inpack.uniqueId = string(s[2])
-			inpack.data = s[3]
-		}
+	inpack.p = p
+	inpack.dataType = p.Type
+	switch p.Type {
+	case protocol.JobAssign:
+		inpack.handle = string(p.Arg(0))
+		inpack.fn = string(p.Arg(1))
+		inpack.data = p.Arg(2)
+	case protocol.JobAssignUniq:
+		inpack.handle = string(p.Arg(0))
+		inpack.fn = string(p.Arg(1))
+		inpack.uniqueId = string(p.Arg(2))
+		inpack.data = p.Arg(3)
+	case protocol.JobAssignAll:
+		inpack.handle = string(p.Arg(0))
+		inpack.fn = string(p.Arg(1))
+		inpack.uniqueId = string(p.Arg(2))
+		inpack.reducer = string(p.Arg(3))
+		inpack.data = p.Arg(4)
 	default:
-		inpack.data = dt
+		inpack.data = p.Body()
 	}
-	l = dl + minPacketLength
 	return
 }
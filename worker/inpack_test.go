@@ -2,30 +2,42 @@ package worker
 
 import (
 	"bytes"
+	"context"
+	"net"
 	"testing"
+
+	"github.com/mikespook/gearman-go/protocol"
 )
 
 var (
-	inpackcases = map[uint32]map[string]string{
-		dtNoop: map[string]string{
+	inpackcases = map[protocol.PacketType]map[string]string{
+		protocol.Noop: map[string]string{
 			"src": "\x00RES\x00\x00\x00\x06\x00\x00\x00\x00",
 		},
-		dtNoJob: map[string]string{
+		protocol.NoJob: map[string]string{
 			"src": "\x00RES\x00\x00\x00\x0a\x00\x00\x00\x00",
 		},
-		dtJobAssign: map[string]string{
+		protocol.JobAssign: map[string]string{
 			"src":    "\x00RES\x00\x00\x00\x0b\x00\x00\x00\x07a\x00b\x00xyz",
 			"handle": "a",
 			"fn":     "b",
 			"data":   "xyz",
 		},
-		dtJobAssignUniq: map[string]string{
+		protocol.JobAssignUniq: map[string]string{
 			"src":    "\x00RES\x00\x00\x00\x1F\x00\x00\x00\x09a\x00b\x00c\x00xyz",
 			"handle": "a",
 			"fn":     "b",
 			"uid":    "c",
 			"data":   "xyz",
 		},
+		protocol.JobAssignAll: map[string]string{
+			"src":     "\x00RES\x00\x00\x00\x28\x00\x00\x00\x0Ba\x00b\x00c\x00d\x00xyz",
+			"handle":  "a",
+			"fn":      "b",
+			"uid":     "c",
+			"reducer": "d",
+			"data":    "xyz",
+		},
 	}
 )
 
@@ -53,6 +65,11 @@ func TestInPack(t *testing.T) {
 				t.Errorf("UID: %s expected, %s got.", uid, inpack.uniqueId)
 			}
 		}
+		if reducer, ok := v["reducer"]; ok {
+			if inpack.reducer != reducer {
+				t.Errorf("Reducer: %s expected, %s got.", reducer, inpack.reducer)
+			}
+		}
 		if data, ok := v["data"]; ok {
 			if bytes.Compare([]byte(data), inpack.data) != 0 {
 				t.Errorf("UID: %v expected, %v got.", data, inpack.data)
@@ -62,12 +79,123 @@ func TestInPack(t *testing.T) {
 }
 
 func BenchmarkDecode(b *testing.B) {
+	srcs := make([][]byte, 0, len(inpackcases))
+	for _, v := range inpackcases {
+		srcs = append(srcs, []byte(v["src"]))
+	}
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		for _, v := range inpackcases {
-			_, _, err := decodeInPack([]byte(v["src"]))
+		for _, src := range srcs {
+			inpack, _, err := decodeInPack(src)
 			if err != nil {
 				b.Error(err)
 			}
+			inpack.release()
+		}
+	}
+}
+
+func TestJobWriter(t *testing.T) {
+	// an in-memory job server
+	server, conn := net.Pipe()
+	defer server.Close()
+	w := New(Unlimited, WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return conn, nil
+	}))
+	if err := w.AddServer(Network, "in-memory"); err != nil {
+		t.Fatal(err)
+	}
+	a := w.agents[0]
+	if err := a.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	output := bytes.Repeat([]byte("0123456789"), ChunkSize/4)
+	w.AddFunc("stream", func(job Job) ([]byte, error) {
+		job.Writer().Write(output[:10])
+		job.Writer().Write(output[10:])
+		return []byte("end"), nil
+	}, 0)
+	w.running = true
+	inpack := getInPack()
+	inpack.a, inpack.handle, inpack.fn = a, "H:1", "stream"
+	go w.exec(inpack)
+
+	var streamed []byte
+	dec := protocol.NewDecoder(server)
+	for {
+		p, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(p.Arg(0)) != "H:1" {
+			t.Errorf("%s expected, %s got.", "H:1", p.Arg(0))
+		}
+		if p.Type == protocol.WorkComplete {
+			if string(p.Arg(1)) != "end" {
+				t.Errorf("%s expected, %s got.", "end", p.Arg(1))
+			}
+			break
+		}
+		if p.Type != protocol.WorkData {
+			t.Fatalf("%s expected, %s got.", protocol.WorkData, p.Type)
+		}
+		if len(p.Arg(1)) > ChunkSize {
+			t.Errorf("At most %d bytes expected, %d got.", ChunkSize, len(p.Arg(1)))
+		}
+		streamed = append(streamed, p.Arg(1)...)
+	}
+	if !bytes.Equal(streamed, output) {
+		t.Errorf("%d bytes expected, %d got.", len(output), len(streamed))
+	}
+}
+
+func TestJobWriterOrder(t *testing.T) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	w := New(Unlimited, WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return conn, nil
+	}))
+	if err := w.AddServer(Network, "in-memory"); err != nil {
+		t.Fatal(err)
+	}
+	a := w.agents[0]
+	if err := a.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	w.AddFunc("mixed", func(job Job) ([]byte, error) {
+		job.Writer().Write([]byte("a"))
+		job.SendData([]byte("b"))
+		job.Writer().Write([]byte("c"))
+		job.UpdateStatus(1, 2)
+		job.SendWarning([]byte("d"))
+		return []byte("e"), nil
+	}, 0)
+	w.running = true
+	inpack := getInPack()
+	inpack.a, inpack.handle, inpack.fn = a, "H:1", "mixed"
+	go w.exec(inpack)
+
+	expected := []struct {
+		t    protocol.PacketType
+		data string
+	}{
+		{protocol.WorkData, "a"},
+		{protocol.WorkData, "b"},
+		{protocol.WorkData, "c"},
+		{protocol.WorkStatus, "1"},
+		{protocol.WorkWarning, "d"},
+		{protocol.WorkComplete, "e"},
+	}
+	dec := protocol.NewDecoder(server)
+	for _, e := range expected {
+		p, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Type != e.t || string(p.Arg(1)) != e.data {
+			t.Errorf("%s %q expected, %s %q got.", e.t, e.data, p.Type, p.Arg(1))
 		}
 	}
 }
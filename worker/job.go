@@ -1,5 +1,12 @@
 package worker
 
+import (
+	"io"
+)
+
+// Job is pooled: neither the job nor the slice returned by Data may
+// be used after the JobFunc or JobHandler returns. Returning Data, or
+// a part of it, from a JobFunc is fine.
 type Job interface {
 	Err() error
 	Data() []byte
@@ -9,4 +16,11 @@ type Job interface {
 	UpdateStatus(numerator, denominator int)
 	Handle() string
 	UniqueId() string
+	// Reducer is only known when the worker grabs with GRAB_JOB_ALL.
+	Reducer() string
+	// Writer streams the output to the client in WORK_DATA packets of
+	// up to ChunkSize bytes. What is buffered is sent when the JobFunc
+	// returns, before its result, or before what is sent by SendData,
+	// SendWarning and UpdateStatus, so the output keeps its order.
+	Writer() io.Writer
 }
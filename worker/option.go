@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/mikespook/gearman-go/internal/transport"
+)
+
+// ServerOption configures the connection to one job server,
+// see (*Worker).AddServer.
+type ServerOption func(*agent)
+
+// WithAllYours sends ALL_YOURS on every (re)connection, telling the
+// job server that this worker is its only consumer.
+func WithAllYours() ServerOption {
+	return func(a *agent) {
+		a.allYours = true
+	}
+}
+
+// WithTLS connects to the job server over TLS with config, also when
+// reconnecting. Set config.Certificates for mutual TLS.
+func WithTLS(config *tls.Config) ServerOption {
+	return func(a *agent) {
+		a.tlsConfig = config
+	}
+}
+
+// Option configures a worker in New.
+type Option func(*Worker)
+
+// DialFunc connects to the job server at addr, eg.
+// (*net.Dialer).DialContext.
+type DialFunc = transport.DialFunc
+
+// WithDialer makes the worker connect with dial, eg. through a proxy.
+// TLS, if any, is handshaked over the connection dial returns.
+func WithDialer(dial DialFunc) Option {
+	return func(worker *Worker) {
+		worker.dialer = dial
+	}
+}
+
+// WithConnectTimeout bounds dialing and the TLS handshake.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(worker *Worker) {
+		worker.connectTimeout = d
+	}
+}
+
+// WithReadTimeout takes the connection as lost when an ECHO_REQ, sent
+// after d of silence, is not answered within d. The agent reconnects
+// on its own.
+func WithReadTimeout(d time.Duration) Option {
+	return func(worker *Worker) {
+		worker.readTimeout = d
+	}
+}
+
+// WithWriteTimeout takes the connection as lost when a write is stuck
+// for d.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(worker *Worker) {
+		worker.writeTimeout = d
+	}
+}
+
+// WithBufferSizes sets the sizes of the read and write buffers of
+// the connections.
+func WithBufferSizes(read, write int) Option {
+	return func(worker *Worker) {
+		worker.readBufferSize = read
+		worker.writeBufferSize = write
+	}
+}
+
+// WithMaxPacketSize bounds the packets read from the job servers to
+// n bytes, protocol.DefaultMaxSize by default. A job of larger data
+// is failed with WORK_FAIL, and the error, a *protocol.SizeError, is
+// given to ErrorHandler.
+func WithMaxPacketSize(n int) Option {
+	return func(worker *Worker) {
+		worker.maxPacketSize = n
+	}
+}
+
+// WithId sets Id, it is sent with SET_CLIENT_ID on every
+// (re)connection.
+func WithId(id string) Option {
+	return func(worker *Worker) {
+		worker.Id = id
+	}
+}
+
+// WithErrorHandler sets ErrorHandler.
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(worker *Worker) {
+		worker.ErrorHandler = h
+	}
+}
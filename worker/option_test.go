@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/mikespook/gearman-go/protocol"
+)
+
+func TestWorkerOptions(t *testing.T) {
+	// an in-memory job server
+	server, conn := net.Pipe()
+	defer server.Close()
+	got := make(chan *protocol.Packet, 1)
+	go func() {
+		p, err := protocol.NewDecoder(server).Decode()
+		if err != nil {
+			t.Error(err)
+			close(got)
+			return
+		}
+		got <- p
+	}()
+	w := New(Unlimited, WithId("worker-1"), WithBufferSizes(64, 64),
+		WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return conn, nil
+		}))
+	if err := w.AddServer(Network, "in-memory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.agents[0].Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.agents[0].Close()
+	p := <-got
+	if p == nil {
+		t.FailNow()
+	}
+	if p.Type != protocol.SetClientId || string(p.Arg(0)) != "worker-1" {
+		t.Errorf("%s %s expected, %s %s got.", protocol.SetClientId, "worker-1",
+			p.Type, p.Arg(0))
+	}
+}
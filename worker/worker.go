@@ -7,6 +7,8 @@ import (
 	"strconv"
 	"sync"
 	"time"
+
+	"github.com/mikespook/gearman-go/protocol"
 )
 
 const (
@@ -27,7 +29,18 @@ type Worker struct {
 	Id           string
 	ErrorHandler ErrorHandler
 	JobHandler   JobHandler
-	limit        chan bool
+	// ConnHandler hears about the connections to every server.
+	// Set it before Ready.
+	ConnHandler ConnHandler
+	// GrabAll makes the worker grab jobs with GRAB_JOB_ALL, so that
+	// Job.Reducer is filled for map/reduce jobs. Set it before Ready.
+	GrabAll bool
+	limit   chan bool
+
+	dialer                                    DialFunc
+	connectTimeout, readTimeout, writeTimeout time.Duration
+	readBufferSize, writeBufferSize           int
+	maxPacketSize                             int
 }
 
 // New returns a worker.
@@ -37,15 +50,23 @@ type Worker struct {
 // If limit is greater than zero, the number of paralled executing
 // jobs are limited under the number. If limit is assgined to
 // OneByOne(=1), there will be only one job executed in a time.
-func New(limit int) (worker *Worker) {
+//
+// opts apply to the connections to all servers.
+func New(limit int, opts ...Option) (worker *Worker) {
 	worker = &Worker{
-		agents: make([]*agent, 0, limit),
-		funcs:  make(jobFuncs),
-		in:     make(chan *inPack, queueSize),
+		agents:          make([]*agent, 0, limit),
+		funcs:           make(jobFuncs),
+		in:              make(chan *inPack, queueSize),
+		readBufferSize:  bufferSize,
+		writeBufferSize: bufferSize,
+		maxPacketSize:   protocol.DefaultMaxSize,
 	}
 	if limit != Unlimited {
 		worker.limit = make(chan bool, limit-1)
 	}
+	for _, opt := range opts {
+		opt(worker)
+	}
 	return
 }
 
@@ -59,21 +80,28 @@ func (worker *Worker) err(e error) {
 // AddServer adds a Gearman job server.
 //
 // addr should be formated as 'host:port'.
-func (worker *Worker) AddServer(net, addr string) (err error) {
+// opts only apply to the connection of this server.
+func (worker *Worker) AddServer(net, addr string,
+	opts ...ServerOption) (err error) {
 	// Create a new job server's client as a agent of server
 	a, err := newAgent(net, addr, worker)
 	if err != nil {
 		return err
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
 	worker.agents = append(worker.agents, a)
 	return
 }
 
 // Broadcast an outpack to all Gearman server.
-func (worker *Worker) broadcast(outpack *outPack) {
+func (worker *Worker) broadcast(outpack *protocol.Packet) {
 	for _, v := range worker.agents {
-		v.Write(outpack)
+		// every write releases its own copy
+		v.Write(getOutPack(outpack.Type, outpack.Args...))
 	}
+	outpack.Release()
 }
 
 // AddFunc adds a function.
@@ -98,22 +126,13 @@ func (worker *Worker) addFunc(funcname string, timeout uint32) {
 	worker.broadcast(outpack)
 }
 
-func prepFuncOutpack(funcname string, timeout uint32) *outPack {
-	outpack := getOutPack()
+func prepFuncOutpack(funcname string, timeout uint32) *protocol.Packet {
 	if timeout == 0 {
-		outpack.dataType = dtCanDo
-		outpack.data = []byte(funcname)
-	} else {
-		outpack.dataType = dtCanDoTimeout
-		l := len(funcname)
-
-		timeoutString := strconv.FormatUint(uint64(timeout), 10)
-		outpack.data = getBuffer(l + len(timeoutString) + 1)
-		copy(outpack.data, []byte(funcname))
-		outpack.data[l] = '\x00'
-		copy(outpack.data[l+1:], []byte(timeoutString))
+		return getOutPack(protocol.CanDo, []byte(funcname))
 	}
-	return outpack
+	timeoutString := strconv.FormatUint(uint64(timeout), 10)
+	return getOutPack(protocol.CanDoTimeout, []byte(funcname),
+		[]byte(timeoutString))
 }
 
 // RemoveFunc removes a function.
@@ -132,20 +151,22 @@ func (worker *Worker) RemoveFunc(funcname string) (err error) {
 
 // inner remove
 func (worker *Worker) removeFunc(funcname string) {
-	outpack := getOutPack()
-	outpack.dataType = dtCantDo
-	outpack.data = []byte(funcname)
+	outpack := getOutPack(protocol.CantDo, []byte(funcname))
 	worker.broadcast(outpack)
 }
 
 // inner package handling
 func (worker *Worker) handleInPack(inpack *inPack) {
 	switch inpack.dataType {
-	case dtNoJob:
+	case protocol.NoJob:
 		inpack.a.PreSleep()
-	case dtNoop:
+		inpack.release()
+	case protocol.Noop:
 		inpack.a.Grab()
-	case dtJobAssign, dtJobAssignUniq:
+		inpack.release()
+	case protocol.JobAssign, protocol.JobAssignUniq, protocol.JobAssignAll:
+		// inpack is released by exec, keep the agent
+		a := inpack.a
 		go func() {
 			if err := worker.exec(inpack); err != nil {
 				worker.err(err)
@@ -154,11 +175,11 @@ func (worker *Worker) handleInPack(inpack *inPack) {
 		if worker.limit != nil {
 			worker.limit <- true
 		}
-		inpack.a.Grab()
-	case dtError:
+		a.Grab()
+	case protocol.Error:
 		worker.err(inpack.Err())
 		fallthrough
-	case dtEchoRes:
+	case protocol.EchoRes:
 		fallthrough
 	default:
 		worker.customeHandler(inpack)
@@ -212,6 +233,7 @@ func (worker *Worker) Work() {
 
 // custome handling warper
 func (worker *Worker) customeHandler(inpack *inPack) {
+	defer inpack.release()
 	if worker.JobHandler != nil {
 		if err := worker.JobHandler(inpack); err != nil {
 			worker.err(err)
@@ -234,27 +256,23 @@ func (worker *Worker) Close() {
 
 // Echo
 func (worker *Worker) Echo(data []byte) {
-	outpack := getOutPack()
-	outpack.dataType = dtEchoReq
-	outpack.data = data
+	outpack := getOutPack(protocol.EchoReq, data)
 	worker.broadcast(outpack)
 }
 
 // Reset removes all of functions.
 // Both from the worker and job servers.
 func (worker *Worker) Reset() {
-	outpack := getOutPack()
-	outpack.dataType = dtResetAbilities
+	outpack := getOutPack(protocol.ResetAbilities)
 	worker.broadcast(outpack)
 	worker.funcs = make(jobFuncs)
 }
 
 // Set the worker's unique id.
+// It is sent again on every reconnection.
 func (worker *Worker) SetId(id string) {
 	worker.Id = id
-	outpack := getOutPack()
-	outpack.dataType = dtSetClientId
-	outpack.data = []byte(id)
+	outpack := getOutPack(protocol.SetClientId, []byte(id))
 	worker.broadcast(outpack)
 }
 
@@ -274,7 +292,9 @@ func (worker *Worker) exec(inpack *inPack) (err error) {
 	}()
 	f, ok := worker.funcs[inpack.fn]
 	if !ok {
-		return fmt.Errorf("The function does not exist: %s", inpack.fn)
+		err = fmt.Errorf("The function does not exist: %s", inpack.fn)
+		inpack.release()
+		return
 	}
 	var r *result
 	if f.timeout == 0 {
@@ -283,20 +303,29 @@ func (worker *Worker) exec(inpack *inPack) (err error) {
 	} else {
 		r = execTimeout(f.f, inpack, time.Duration(f.timeout)*time.Second)
 	}
+	if r.err != ErrTimeOut {
+		// What is streamed goes before the result.
+		if e := inpack.flush(); e != nil && r.err == nil {
+			r = &result{err: e}
+		}
+		// The result may share memory with the job's data, release
+		// it after the result is written. A timed out job may still
+		// be running, so it is left to the GC.
+		defer inpack.release()
+	}
 	if worker.running {
-		outpack := getOutPack()
+		var outpack *protocol.Packet
+		handle := []byte(inpack.handle)
 		if r.err == nil {
-			outpack.dataType = dtWorkComplete
+			outpack = getOutPack(protocol.WorkComplete, handle, r.data)
 		} else {
 			if len(r.data) == 0 {
-				outpack.dataType = dtWorkFail
+				outpack = getOutPack(protocol.WorkFail, handle)
 			} else {
-				outpack.dataType = dtWorkException
+				outpack = getOutPack(protocol.WorkException, handle, r.data)
 			}
 			err = r.err
 		}
-		outpack.handle = inpack.handle
-		outpack.data = r.data
 		inpack.a.Write(outpack)
 	}
 	return